@@ -2,7 +2,19 @@ package zerosdk
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
 
 	"github.com/pomerium/zero-sdk/apierror"
 	cluster_api "github.com/pomerium/zero-sdk/cluster"
@@ -18,8 +30,30 @@ type API struct {
 	cluster          cluster_api.ClientWithResponsesInterface
 	mux              *connect_mux.Mux
 	downloadURLCache *cluster_api.URLCache
+	downloadClient   *http.Client
+	downloadParams   singleflight.Group
+	downloadsMx      sync.Mutex
+	downloads        map[string]*downloadFlight
+	tracer           trace.Tracer
+	metrics          *metrics
+	logger           zerolog.Logger
+
+	bootstrapCache      *bootstrapConfigCache
+	bootstrapRefreshing atomic.Bool
+
+	tokenCache    *token_api.Cache
+	connectClient connect_api.Client
+	closeMx       sync.RWMutex
+	closed        chan struct{}
+	reports       sync.WaitGroup
 }
 
+// ErrClosed is returned when the API is used after it was closed
+var ErrClosed = errors.New("API is closed")
+
+// maxReportsFlushWait is how long Close waits for the pending status reports to complete
+const maxReportsFlushWait = 10 * time.Second
+
 // WatchOption defines which events to watch for
 type WatchOption = connect_mux.WatchOption
 
@@ -30,66 +64,247 @@ func NewAPI(ctx context.Context, opts ...Option) (*API, error) {
 		return nil, err
 	}
 
-	fetcher, err := cluster_api.NewTokenFetcher(cfg.clusterAPIEndpoint,
-		cluster_api.WithHTTPClient(cfg.httpClient),
+	tracer := cfg.tracerProvider.Tracer(instrumentationName)
+	metrics := newMetrics(cfg.meterProvider, cfg.metricAttributes)
+	clusterHTTPClient := newRetryClient(
+		newMetricsClient(newTracingClient(cfg.httpClient, tracer, cfg.propagator), metrics),
+		cfg.retryPolicy,
+		cfg.clock,
+	)
+
+	fetcher, err := cluster_api.NewTokenFetcherWithClock(cfg.clusterAPIEndpoint, cfg.clock,
+		cluster_api.WithHTTPClient(clusterHTTPClient),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error creating token fetcher: %w", err)
 	}
 
-	tokenCache := token_api.NewCache(fetcher, cfg.apiToken)
+	tokenCache := token_api.NewCache(traceFetcher(tracer, meterFetcher(metrics, fetcher)), cfg.apiToken,
+		token_api.WithClock(cfg.clock),
+	)
 
-	clusterClient, err := cluster_api.NewAuthorizedClient(cfg.clusterAPIEndpoint, tokenCache.GetToken, cfg.httpClient)
+	clusterClient, err := cluster_api.NewAuthorizedClient(cfg.clusterAPIEndpoint, tokenCache.GetToken, clusterHTTPClient)
 	if err != nil {
 		return nil, fmt.Errorf("error creating cluster client: %w", err)
 	}
 
-	connectClient, err := connect_api.NewAuthorizedConnectClient(ctx, cfg.connectAPIEndpoint, tokenCache.GetToken)
+	var connectClient connect_api.Client
+	if cfg.shared != nil && cfg.shared.connectPool != nil {
+		connectClient, err = cfg.shared.connectPool.NewAuthorizedConnectClient(ctx, cfg.connectAPIEndpoint, tokenCache.GetToken)
+	} else {
+		connectClient, err = connect_api.NewAuthorizedConnectClient(ctx, cfg.connectAPIEndpoint, tokenCache.GetToken,
+			connectOptions(cfg)...)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error creating connect client: %w", err)
 	}
 
-	return &API{
-		cfg:              cfg,
-		cluster:          clusterClient,
-		mux:              connect_mux.New(connectClient),
-		downloadURLCache: cluster_api.NewURLCache(),
-	}, nil
+	api := &API{
+		cfg:     cfg,
+		cluster: clusterClient,
+		mux: connect_mux.New(connectClient,
+			connect_mux.WithTracerProvider(cfg.tracerProvider),
+			connect_mux.WithMeterProvider(cfg.meterProvider),
+			connect_mux.WithMetricAttributes(cfg.metricAttributes...),
+			connect_mux.WithLogger(cfg.logger),
+			connect_mux.WithClock(cfg.clock),
+		),
+		downloadURLCache: cluster_api.NewURLCache(cluster_api.WithURLCacheClock(cfg.clock)),
+		// the trace context is not propagated to the cloud storage
+		downloadClient: newTracingClient(cfg.httpClient, tracer, nil),
+		downloads:      make(map[string]*downloadFlight),
+		tracer:         tracer,
+		metrics:        metrics,
+		logger:         cfg.logger,
+		tokenCache:     tokenCache,
+		connectClient:  connectClient,
+		closed:         make(chan struct{}),
+	}
+
+	if cfg.bootstrapConfigCachePath != "" {
+		key := cfg.bootstrapConfigCacheKey
+		if key == nil {
+			key = []byte(cfg.apiToken)
+		}
+		api.bootstrapCache, err = newBootstrapConfigCache(cfg.bootstrapConfigCachePath, key)
+		if err != nil {
+			_ = connectClient.Close()
+			return nil, fmt.Errorf("error creating bootstrap config cache: %w", err)
+		}
+	}
+
+	return api, nil
+}
+
+func connectOptions(cfg *config) []connect_api.Option {
+	return []connect_api.Option{
+		connect_api.WithTLSConfig(cfg.tlsConfig),
+		connect_api.WithProxy(cfg.proxy),
+		connect_api.WithDialOptions(grpc.WithChainStreamInterceptor(streamClientInterceptor(cfg.propagator))),
+	}
 }
 
-// Connect connects to the connect API and allows watching for changes
+// Connect connects to the connect API and allows watching for changes.
+// It blocks until the context is canceled or the API is closed, and may be called again once it returns.
 func (api *API) Connect(ctx context.Context, opts ...fanout.Option) error {
-	return api.mux.Run(ctx, opts...)
+	if api.isClosed() {
+		return ErrClosed
+	}
+	// Close closes the mux, so a run racing it is either stopped or rejected with ErrStopped
+	err := api.mux.Run(ctx, opts...)
+	if errors.Is(err, connect_mux.ErrStopped) && api.isClosed() {
+		return ErrClosed
+	}
+	return err
+}
+
+// Close stops the connection to the connect API and the watchers,
+// waits for the pending bundle status reports to complete,
+// and releases the gRPC connection and the idle HTTP connections.
+// The API may not be used once it is closed.
+func (api *API) Close() error {
+	api.closeMx.Lock()
+	if api.isClosed() {
+		api.closeMx.Unlock()
+		return nil
+	}
+	close(api.closed)
+	api.closeMx.Unlock()
+
+	var errs *multierror.Error
+	if err := api.mux.Close(); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("error closing connect mux: %w", err))
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		api.reports.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-api.cfg.clock.After(maxReportsFlushWait):
+		api.logger.Warn().Msg("timed out waiting for pending bundle status reports")
+	}
+
+	if err := api.connectClient.Close(); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("error closing connect client: %w", err))
+	}
+	if api.cfg.shared == nil {
+		// the shared client is used by the other clusters
+		api.cfg.httpClient.CloseIdleConnections()
+	}
+	return errs.ErrorOrNil()
+}
+
+func (api *API) isClosed() bool {
+	select {
+	case <-api.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// trackReport registers the pending status report, that Close waits for
+func (api *API) trackReport() (done func(), err error) {
+	api.closeMx.RLock()
+	defer api.closeMx.RUnlock()
+
+	if api.isClosed() {
+		return nil, ErrClosed
+	}
+	api.reports.Add(1)
+	return api.reports.Done, nil
+}
+
+// withClose returns the context, that is also canceled once the API is closed
+func (api *API) withClose(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-api.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
 // Watch dispatches API updates
 func (api *API) Watch(ctx context.Context, opts ...WatchOption) error {
-	return api.mux.Watch(ctx, opts...)
+	if api.isClosed() {
+		return ErrClosed
+	}
+	err := api.mux.Watch(ctx, opts...)
+	if errors.Is(err, connect_mux.ErrStopped) && api.isClosed() {
+		return ErrClosed
+	}
+	return err
+}
+
+// GetToken returns the current identity token, exchanging the API token for a new one if needed.
+// It is meant for diagnostics, the API authorizes its requests by itself.
+func (api *API) GetToken(ctx context.Context) (*token_api.Token, error) {
+	bearer, err := api.tokenCache.GetToken(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &token_api.Token{Bearer: bearer, Expires: api.tokenCache.Expires()}, nil
 }
 
 // GetClusterBootstrapConfig fetches the bootstrap configuration from the cluster API
-func (api *API) GetClusterBootstrapConfig(ctx context.Context) (*cluster_api.BootstrapConfig, error) {
-	return apierror.CheckResponse[cluster_api.BootstrapConfig](
+func (api *API) GetClusterBootstrapConfig(ctx context.Context) (_ *cluster_api.BootstrapConfig, err error) {
+	ctx, span := api.startSpan(ctx, "getClusterBootstrapConfig")
+	defer func() { endSpan(span, err) }()
+
+	now := api.cfg.clock.Now()
+	cfg, err := apierror.CheckResponse[cluster_api.BootstrapConfig](
 		api.cluster.GetClusterBootstrapConfigWithResponse(ctx),
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	if api.bootstrapCache != nil {
+		if err := api.bootstrapCache.save(cfg, now); err != nil {
+			api.logger.Error().Err(err).Msg("error saving bootstrap config cache")
+		}
+	}
+	return cfg, nil
 }
 
 // GetClusterResourceBundles fetches the resource bundles from the cluster API
-func (api *API) GetClusterResourceBundles(ctx context.Context) (*cluster_api.GetBundlesResponse, error) {
+func (api *API) GetClusterResourceBundles(ctx context.Context) (_ *cluster_api.GetBundlesResponse, err error) {
+	ctx, span := api.startSpan(ctx, "getClusterResourceBundles")
+	defer func() { endSpan(span, err) }()
+
 	return apierror.CheckResponse[cluster_api.GetBundlesResponse](
 		api.cluster.GetClusterResourceBundlesWithResponse(ctx),
 	)
 }
 
 // ReportBundleAppliedSuccess reports a successful bundle application
-func (api *API) ReportBundleAppliedSuccess(ctx context.Context, bundleID string, metadata map[string]string) error {
+func (api *API) ReportBundleAppliedSuccess(ctx context.Context, bundleID string, metadata map[string]string) (err error) {
+	done, err := api.trackReport()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	ctx, span := api.startSpan(ctx, "reportClusterResourceBundleStatus",
+		attribute.String("zero.bundle_id", bundleID),
+		attribute.Bool("zero.bundle_status.success", true),
+	)
+	defer func() { endSpan(span, err) }()
+
 	status := cluster_api.BundleStatus{
 		Success: &cluster_api.BundleStatusSuccess{
 			Metadata: metadata,
 		},
 	}
 
-	_, err := apierror.CheckResponse[cluster_api.EmptyResponse](
+	_, err = apierror.CheckResponse[cluster_api.EmptyResponse](
 		api.cluster.ReportClusterResourceBundleStatusWithResponse(ctx, bundleID, status),
 	)
 	if err != nil {
@@ -103,11 +318,24 @@ func (api *API) ReportBundleAppliedFailure(
 	ctx context.Context,
 	bundleID string,
 	source cluster_api.BundleStatusFailureSource,
-	err error,
-) error {
+	applyErr error,
+) (err error) {
+	done, err := api.trackReport()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	ctx, span := api.startSpan(ctx, "reportClusterResourceBundleStatus",
+		attribute.String("zero.bundle_id", bundleID),
+		attribute.Bool("zero.bundle_status.success", false),
+		attribute.String("zero.bundle_status.failure_source", string(source)),
+	)
+	defer func() { endSpan(span, err) }()
+
 	status := cluster_api.BundleStatus{
 		Failure: &cluster_api.BundleStatusFailure{
-			Message: err.Error(),
+			Message: applyErr.Error(),
 			Source:  source,
 		},
 	}
@@ -0,0 +1,352 @@
+package zerosdk_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	connect_mux "github.com/pomerium/zero-sdk/connect-mux"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// newTestAPI creates the API client of the test server with the given options, that is closed once the test completes
+func newTestAPI(t *testing.T, srv *zerotest.Server, opts ...zerosdk.Option) *zerosdk.API {
+	t.Helper()
+
+	api, err := zerosdk.NewAPI(testContext(t), append(srv.Options(), opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = api.Close() })
+	return api
+}
+
+func TestAPI(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	dsn := "postgres://localhost:5432/databroker"
+	srv.SetBootstrapConfig(cluster_api.BootstrapConfig{DatabrokerStorageConnection: &dsn})
+	srv.SetBundle("config", []byte("bundle-data"),
+		zerotest.WithBundleGzip(),
+		zerotest.WithBundleMetadata(map[string]string{"X-Bundle-Version": "1"}),
+	)
+
+	api := newTestAPI(t, srv)
+
+	t.Run("bootstrap config", func(t *testing.T) {
+		cfg, err := api.GetClusterBootstrapConfig(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, cfg.DatabrokerStorageConnection)
+		assert.Equal(t, dsn, *cfg.DatabrokerStorageConnection)
+	})
+
+	t.Run("bundles", func(t *testing.T) {
+		bundles, err := api.GetClusterResourceBundles(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []cluster_api.Bundle{{Id: "config"}}, bundles.Bundles)
+	})
+
+	t.Run("download", func(t *testing.T) {
+		var buf bytes.Buffer
+		res, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+		require.NoError(t, err)
+		assert.False(t, res.NotModified)
+		assert.Equal(t, "bundle-data", buf.String())
+		assert.Equal(t, map[string]string{"X-Bundle-Version": "1"}, res.Metadata)
+
+		buf.Reset()
+		res, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", res.DownloadConditional)
+		require.NoError(t, err)
+		assert.True(t, res.NotModified)
+		assert.Zero(t, buf.Len())
+		assert.Equal(t, 1, srv.RequestCount("DownloadClusterResourceBundle"), "download URL should be cached")
+
+		_, err = api.DownloadClusterResourceBundle(ctx, &buf, "missing", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("report status", func(t *testing.T) {
+		require.NoError(t, api.ReportBundleAppliedSuccess(ctx, "config", map[string]string{"k": "v"}))
+		require.NoError(t, api.ReportBundleAppliedFailure(ctx, "config", cluster_api.InvalidBundle, errors.New("bad bundle")))
+		assert.Equal(t, []cluster_api.BundleStatus{
+			{Success: &cluster_api.BundleStatusSuccess{Metadata: map[string]string{"k": "v"}}},
+			{Failure: &cluster_api.BundleStatusFailure{Source: cluster_api.InvalidBundle, Message: "bad bundle"}},
+		}, srv.BundleStatuses("config"))
+	})
+}
+
+func TestAPIInvalidToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	api := newTestAPI(t, srv, zerosdk.WithAPIToken("invalid"))
+
+	_, err := api.GetClusterBootstrapConfig(ctx)
+	assert.Error(t, err)
+	assert.Zero(t, srv.RequestCount("GetClusterBootstrapConfig"))
+}
+
+func TestAPIWatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	api := newTestAPI(t, srv)
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	go func() { _ = api.Connect(ctx) }()
+
+	events := make(chan string, 16)
+	go func() {
+		_ = api.Watch(ctx,
+			connect_mux.WithOnConnected(func(_ context.Context) { events <- "connected" }),
+			connect_mux.WithOnDisconnected(func(_ context.Context) { events <- "disconnected" }),
+			connect_mux.WithOnBundleUpdated(func(_ context.Context, key string) { events <- "bundle:" + key }),
+			connect_mux.WithOnBootstrapConfigUpdated(func(_ context.Context) { events <- "bootstrap" }),
+		)
+	}()
+
+	next := func() string {
+		t.Helper()
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for event")
+			return ""
+		case evt := <-events:
+			return evt
+		}
+	}
+	nextSkipping := func(skip string) string {
+		t.Helper()
+		for {
+			if evt := next(); evt != skip {
+				return evt
+			}
+		}
+	}
+
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+	// the watcher may only subscribe to the mux after the initial connection state was delivered,
+	// so keep publishing until the first message goes through
+	require.Eventually(t, func() bool {
+		srv.PublishConfigUpdated(1)
+		for {
+			select {
+			case evt := <-events:
+				if evt == "bundle:config" {
+					return true
+				}
+			case <-time.After(time.Millisecond * 50):
+				return false
+			}
+		}
+	}, time.Second*5, time.Millisecond)
+
+	srv.PublishBootstrapConfigUpdated()
+	assert.Equal(t, "bootstrap", nextSkipping("bundle:config"))
+
+	srv.DropStreams()
+	assert.Equal(t, "disconnected", next())
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+	assert.Equal(t, "connected", next())
+
+	srv.PublishConfigUpdated(2)
+	assert.Equal(t, "bundle:config", next())
+}
+
+func TestAPIClose(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	api := newTestAPI(t, srv)
+
+	t.Run("reconnect", func(t *testing.T) {
+		connectCtx, cancel := context.WithCancel(ctx)
+		errc := make(chan error, 1)
+		go func() { errc <- api.Connect(connectCtx) }()
+		require.NoError(t, srv.WaitForStreams(ctx, 1))
+
+		cancel()
+		assert.ErrorIs(t, <-errc, context.Canceled)
+		assert.Eventually(t, func() bool { return srv.StreamCount() == 0 },
+			time.Second*5, time.Millisecond*10, "stream should be closed")
+	})
+
+	errc := make(chan error, 1)
+	go func() { errc <- api.Connect(ctx) }()
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+
+	connected := make(chan struct{}, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- api.Watch(ctx, connect_mux.WithOnConnected(func(_ context.Context) {
+			connected <- struct{}{}
+		}))
+	}()
+	select {
+	case <-connected:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the watcher")
+	}
+
+	require.NoError(t, api.Close())
+	assert.ErrorIs(t, <-errc, zerosdk.ErrClosed)
+	assert.Error(t, <-watchErr, "watchers should be stopped")
+	assert.Eventually(t, func() bool { return srv.StreamCount() == 0 },
+		time.Second*5, time.Millisecond*10, "stream should be closed")
+
+	assert.ErrorIs(t, api.Connect(ctx), zerosdk.ErrClosed)
+	assert.ErrorIs(t, api.Watch(ctx), zerosdk.ErrClosed)
+	assert.ErrorIs(t, api.ReportBundleAppliedSuccess(ctx, "config", nil), zerosdk.ErrClosed)
+	assert.NoError(t, api.Close(), "closing twice should be a no-op")
+}
+
+func TestAPICloseWatching(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	api := newTestAPI(t, srv)
+
+	// the watcher waits for the API to be connected, that never happens
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- api.Watch(ctx) }()
+
+	require.NoError(t, api.Close())
+	select {
+	case err := <-watchErr:
+		assert.ErrorIs(t, err, zerosdk.ErrClosed)
+	case <-ctx.Done():
+		t.Fatal("the watcher should be stopped once the API is closed")
+	}
+}
+
+func TestAPIStatus(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	api := newTestAPI(t, srv)
+
+	status := api.Status()
+	assert.False(t, status.Running)
+	assert.False(t, status.Connected)
+	assert.True(t, status.TokenExpires.IsZero())
+	assert.Empty(t, status.DownloadURLs)
+
+	var buf bytes.Buffer
+	_, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+	require.NoError(t, err)
+
+	status = api.Status()
+	assert.True(t, status.TokenExpires.After(time.Now()))
+	assert.Contains(t, status.DownloadURLs, "config")
+
+	go func() { _ = api.Connect(ctx) }()
+	received := make(chan struct{}, 1)
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	go func() {
+		_ = api.Watch(watchCtx, connect_mux.WithOnBundleUpdated(func(_ context.Context, _ string) {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		}))
+	}()
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+	require.Eventually(t, func() bool {
+		srv.PublishConfigUpdated(1)
+		select {
+		case <-received:
+			return true
+		case <-time.After(time.Millisecond * 50):
+			return false
+		}
+	}, time.Second*5, time.Millisecond)
+
+	status = api.Status()
+	assert.True(t, status.Running)
+	assert.True(t, status.Connected)
+	assert.Equal(t, 1, status.Subscribers)
+	assert.False(t, status.LastConnected.IsZero())
+	assert.False(t, status.LastMessage.IsZero())
+	assert.NoError(t, status.LastError)
+
+	stopWatching()
+	assert.Eventually(t, func() bool { return api.Status().Subscribers == 0 },
+		time.Second*5, time.Millisecond*10, "the watcher should be unsubscribed")
+
+	srv.DropStreams()
+	require.Eventually(t, func() bool {
+		status = api.Status()
+		return !status.LastDisconnected.IsZero() && status.LastError != nil
+	}, time.Second*5, time.Millisecond*10)
+
+	require.NoError(t, api.Close())
+	status = api.Status()
+	assert.True(t, status.Closed)
+	assert.False(t, status.Running)
+	assert.False(t, status.Connected)
+}
+
+func TestAPILogger(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	var buf bytes.Buffer
+	logger := zerolog.New(zerolog.SyncWriter(&buf)).Level(zerolog.DebugLevel)
+	api := newTestAPI(t, srv, zerosdk.WithLogger(&logger))
+
+	_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+	require.NoError(t, err)
+
+	connectCtx, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() { errc <- api.Connect(connectCtx) }()
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+	srv.PublishConfigUpdated(1)
+	assert.Eventually(t, func() bool { return api.Status().LastMessage.After(time.Time{}) },
+		time.Second*5, time.Millisecond*10)
+	cancel()
+	<-errc
+	require.NoError(t, api.Close())
+
+	logs := buf.String()
+	assert.Contains(t, logs, `"bundle_id":"config"`)
+	assert.Contains(t, logs, `"message":"bundle downloaded"`)
+	assert.Contains(t, logs, `"message_type":"config_updated"`)
+
+	api, err = zerosdk.NewAPI(ctx, append(srv.Options(), zerosdk.WithLogger(nil))...)
+	require.NoError(t, err, "nil logger disables logging")
+	assert.NoError(t, api.Close())
+}
@@ -27,18 +27,27 @@ func (e *terminalError) Is(err error) bool {
 	return ok
 }
 
-func (e *terminalError) IsTerminal() {}
+// IsTerminal implements TerminalError for terminalError
+func (e *terminalError) IsTerminal() bool { return true }
+
+// TerminalError is implemented by the errors that know whether they may be retried
+type TerminalError interface {
+	error
+	// IsTerminal returns true if the error should not be retried
+	IsTerminal() bool
+}
 
 // NewTerminalError creates a new terminal error that cannot be retried
 func NewTerminalError(err error) error {
 	return &terminalError{Err: err}
 }
 
-// IsTerminalError returns true if the error is a terminal error
+// IsTerminalError returns true if the error is a terminal error,
+// or an error that reports itself terminal with TerminalError
 func IsTerminalError(err error) bool {
 	if err == nil {
 		return false
 	}
-	var te *terminalError
-	return errors.As(err, &te)
+	var te TerminalError
+	return errors.As(err, &te) && te.IsTerminal()
 }
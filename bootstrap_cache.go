@@ -0,0 +1,158 @@
+package zerosdk
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pomerium/zero-sdk/apierror"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+)
+
+const bootstrapConfigCacheLabel = "pomerium-zero-sdk/bootstrap-config/v1"
+
+// ErrNoBootstrapConfigCache is returned when the bootstrap config cannot be fetched,
+// and there is no last known bootstrap config to fall back to
+var ErrNoBootstrapConfigCache = errors.New("no cached bootstrap config")
+
+// BootstrapConfigResult is the bootstrap config, that may be served from the local cache
+type BootstrapConfigResult struct {
+	*cluster_api.BootstrapConfig
+	// Stale is true if the cluster API could not be reached,
+	// and the last known bootstrap config was returned instead
+	Stale bool
+	// FetchedAt is the time the bootstrap config was fetched from the cluster API
+	FetchedAt time.Time
+	// Err is the error fetching the bootstrap config, if it is stale
+	Err error
+}
+
+// GetClusterBootstrapConfigWithFallback fetches the bootstrap configuration from the cluster API.
+// If the API is unavailable, the last known bootstrap config is returned flagged as stale,
+// and it is refreshed in the background until the context is canceled or the API is closed.
+// onRefreshed is called once the fresh bootstrap config was fetched, and may be nil.
+//
+// The fallback requires WithBootstrapConfigCache option, otherwise it behaves like GetClusterBootstrapConfig.
+func (api *API) GetClusterBootstrapConfigWithFallback(
+	ctx context.Context,
+	onRefreshed func(context.Context, *cluster_api.BootstrapConfig),
+) (*BootstrapConfigResult, error) {
+	now := api.cfg.clock.Now()
+	cfg, err := api.GetClusterBootstrapConfig(ctx)
+	if err == nil {
+		return &BootstrapConfigResult{BootstrapConfig: cfg, FetchedAt: now}, nil
+	}
+	if api.bootstrapCache == nil || apierror.IsTerminalError(err) || ctx.Err() != nil {
+		return nil, err
+	}
+
+	cached, loadErr := api.bootstrapCache.load()
+	if loadErr != nil {
+		return nil, fmt.Errorf("%w (%v): %w", ErrNoBootstrapConfigCache, loadErr, err)
+	}
+
+	if api.bootstrapRefreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer api.bootstrapRefreshing.Store(false)
+
+			ctx, cancel := api.withClose(ctx)
+			defer cancel()
+			api.refreshBootstrapConfig(ctx, onRefreshed)
+		}()
+	}
+
+	return &BootstrapConfigResult{
+		BootstrapConfig: &cached.Config,
+		Stale:           true,
+		FetchedAt:       cached.FetchedAt,
+		Err:             err,
+	}, nil
+}
+
+func (api *API) refreshBootstrapConfig(
+	ctx context.Context,
+	onRefreshed func(context.Context, *cluster_api.BootstrapConfig),
+) {
+	cfg, err := api.fetchBootstrapConfig(ctx)
+	if err != nil {
+		api.logger.Error().Err(err).Msg("bootstrap config refresh stopped")
+		return
+	}
+
+	if onRefreshed != nil {
+		onRefreshed(ctx, cfg)
+	}
+}
+
+// bootstrapConfigCache persists the last known bootstrap config encrypted at rest,
+// as it contains the databroker storage connection string
+type bootstrapConfigCache struct {
+	path string
+	aead cipher.AEAD
+}
+
+type cachedBootstrapConfig struct {
+	Config    cluster_api.BootstrapConfig `json:"config"`
+	FetchedAt time.Time                   `json:"fetchedAt"`
+}
+
+func newBootstrapConfigCache(path string, key []byte) (*bootstrapConfigCache, error) {
+	h := sha256.New()
+	_, _ = h.Write([]byte(bootstrapConfigCacheLabel))
+	_, _ = h.Write(key)
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create aead: %w", err)
+	}
+	return &bootstrapConfigCache{path: path, aead: aead}, nil
+}
+
+func (c *bootstrapConfigCache) save(cfg *cluster_api.BootstrapConfig, fetchedAt time.Time) error {
+	plaintext, err := json.Marshal(cachedBootstrapConfig{Config: *cfg, FetchedAt: fetchedAt})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+
+	data := c.aead.Seal(nonce, nonce, plaintext, []byte(bootstrapConfigCacheLabel))
+	return writeFileAtomic(c.path, data)
+}
+
+func (c *bootstrapConfigCache) load() (*cachedBootstrapConfig, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	if len(data) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("invalid cache file")
+	}
+
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(bootstrapConfigCacheLabel))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	var cached cachedBootstrapConfig
+	if err := json.Unmarshal(plaintext, &cached); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return &cached, nil
+}
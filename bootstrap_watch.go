@@ -0,0 +1,189 @@
+package zerosdk
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pomerium/zero-sdk/apierror"
+	"github.com/pomerium/zero-sdk/clock"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	connect_mux "github.com/pomerium/zero-sdk/connect-mux"
+)
+
+// BootstrapConfigChange describes a change of the bootstrap config
+type BootstrapConfigChange struct {
+	// Old is the previous bootstrap config, nil for the first one received
+	Old *cluster_api.BootstrapConfig
+	// New is the current bootstrap config
+	New *cluster_api.BootstrapConfig
+	// Fields lists the fields that differ between Old and New
+	Fields []BootstrapConfigFieldChange
+}
+
+// BootstrapConfigFieldChange describes a change of a single bootstrap config field
+type BootstrapConfigFieldChange struct {
+	// Field is the JSON name of the field, i.e. databrokerStorageConnection
+	Field string
+	// Old is the previous value of the field, nil if it was not set
+	Old any
+	// New is the current value of the field, nil if it is not set
+	New any
+}
+
+// WatchBootstrapConfig fetches the bootstrap config when the connection to the cloud is established,
+// and whenever the bootstrap config update is received, calling onChange if it differs from the previous one.
+// The failed fetches are retried with a backoff until they succeed, unless the error is terminal.
+// It blocks until the context is canceled, and requires the API to be connected (see API.Connect).
+func (api *API) WatchBootstrapConfig(
+	ctx context.Context,
+	onChange func(context.Context, BootstrapConfigChange),
+) error {
+	updates := make(chan struct{}, 1)
+	notify := func(_ context.Context) {
+		select {
+		case updates <- struct{}{}:
+		default:
+		}
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- api.Watch(ctx,
+			connect_mux.WithOnConnected(notify),
+			connect_mux.WithOnBootstrapConfigUpdated(notify),
+		)
+	}()
+
+	var current *cluster_api.BootstrapConfig
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case <-updates:
+		}
+
+		cfg, err := api.fetchBootstrapConfig(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			api.logger.Error().Err(err).Msg("error fetching bootstrap config")
+			continue
+		}
+
+		fields := DiffBootstrapConfig(current, cfg)
+		if current != nil && len(fields) == 0 {
+			continue
+		}
+
+		onChange(ctx, BootstrapConfigChange{Old: current, New: cfg, Fields: fields})
+		current = cfg
+	}
+}
+
+// fetchBootstrapConfig fetches the bootstrap config, retrying until it succeeds,
+// the error is terminal or the context is done
+func (api *API) fetchBootstrapConfig(ctx context.Context) (*cluster_api.BootstrapConfig, error) {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = 0
+	bo.Clock = api.cfg.clock
+	bo.Reset()
+
+	return backoff.RetryNotifyWithTimerAndData(func() (*cluster_api.BootstrapConfig, error) {
+		cfg, err := api.GetClusterBootstrapConfig(ctx)
+		if apierror.IsTerminalError(err) {
+			return nil, backoff.Permanent(err)
+		}
+		return cfg, err
+	}, backoff.WithContext(bo, ctx), func(err error, next time.Duration) {
+		api.logger.Warn().Err(err).Dur("next", next).Msg("error fetching bootstrap config, retrying")
+	}, &backoffTimer{clock: api.cfg.clock})
+}
+
+// backoffTimer is the backoff.Timer of the clock
+type backoffTimer struct {
+	clock clock.Clock
+	timer clock.Timer
+}
+
+// Start implements backoff.Timer
+func (t *backoffTimer) Start(d time.Duration) {
+	if t.timer == nil {
+		t.timer = t.clock.NewTimer(d)
+		return
+	}
+	t.timer.Reset(d)
+}
+
+// Stop implements backoff.Timer
+func (t *backoffTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// C implements backoff.Timer
+func (t *backoffTimer) C() <-chan time.Time {
+	return t.timer.C()
+}
+
+// DiffBootstrapConfig returns the fields that differ between the two bootstrap configs,
+// either of which may be nil
+func DiffBootstrapConfig(old, updated *cluster_api.BootstrapConfig) []BootstrapConfigFieldChange {
+	var oldValue, newValue reflect.Value
+	if old != nil {
+		oldValue = reflect.ValueOf(old).Elem()
+	}
+	if updated != nil {
+		newValue = reflect.ValueOf(updated).Elem()
+	}
+
+	var changes []BootstrapConfigFieldChange
+	typ := reflect.TypeOf(cluster_api.BootstrapConfig{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		o, n := fieldValue(oldValue, i), fieldValue(newValue, i)
+		if reflect.DeepEqual(o, n) {
+			continue
+		}
+		changes = append(changes, BootstrapConfigFieldChange{
+			Field: jsonFieldName(field),
+			Old:   o,
+			New:   n,
+		})
+	}
+	return changes
+}
+
+// fieldValue returns the value of the struct field, dereferencing pointers;
+// nil is returned for nil pointers or if the struct itself is not valid
+func fieldValue(v reflect.Value, i int) any {
+	if !v.IsValid() {
+		return nil
+	}
+	f := v.Field(i)
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			return nil
+		}
+		f = f.Elem()
+	}
+	return f.Interface()
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,145 @@
+package zerosdk_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func TestDiffBootstrapConfig(t *testing.T) {
+	t.Parallel()
+
+	a, b := "a", "b"
+	for _, tc := range []struct {
+		name     string
+		old, new *cluster_api.BootstrapConfig
+		want     []zerosdk.BootstrapConfigFieldChange
+	}{
+		{"both nil", nil, nil, nil},
+		{"equal", &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &a}, &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &a}, nil},
+		{"empty", nil, &cluster_api.BootstrapConfig{}, nil},
+		{
+			"set", nil, &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &a},
+			[]zerosdk.BootstrapConfigFieldChange{{Field: "databrokerStorageConnection", Old: nil, New: "a"}},
+		},
+		{
+			"changed", &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &a}, &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &b},
+			[]zerosdk.BootstrapConfigFieldChange{{Field: "databrokerStorageConnection", Old: "a", New: "b"}},
+		},
+		{
+			"unset", &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &a}, &cluster_api.BootstrapConfig{},
+			[]zerosdk.BootstrapConfigFieldChange{{Field: "databrokerStorageConnection", Old: "a", New: nil}},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, zerosdk.DiffBootstrapConfig(tc.old, tc.new))
+		})
+	}
+}
+
+func TestWatchBootstrapConfig(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	v1, v2 := "v1", "v2"
+	srv.SetBootstrapConfig(cluster_api.BootstrapConfig{DatabrokerStorageConnection: &v1})
+
+	api := newTestAPI(t, srv)
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	go func() { _ = api.Connect(ctx) }()
+
+	changes := make(chan zerosdk.BootstrapConfigChange, 16)
+	go func() {
+		_ = api.WatchBootstrapConfig(ctx, func(_ context.Context, change zerosdk.BootstrapConfigChange) {
+			changes <- change
+		})
+	}()
+
+	next := func() zerosdk.BootstrapConfigChange {
+		t.Helper()
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for bootstrap config change")
+			return zerosdk.BootstrapConfigChange{}
+		case change := <-changes:
+			return change
+		}
+	}
+
+	change := next()
+	assert.Nil(t, change.Old)
+	assert.Equal(t, &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &v1}, change.New)
+
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+	// identical config is not delivered again
+	srv.PublishBootstrapConfigUpdated()
+	srv.SetBootstrapConfig(cluster_api.BootstrapConfig{DatabrokerStorageConnection: &v2})
+	// the watcher may not have subscribed yet, so keep publishing until the change is delivered
+	for {
+		srv.PublishBootstrapConfigUpdated()
+		select {
+		case change = <-changes:
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for bootstrap config change")
+		case <-time.After(time.Millisecond * 50):
+			continue
+		}
+		break
+	}
+	assert.Equal(t, []zerosdk.BootstrapConfigFieldChange{
+		{Field: "databrokerStorageConnection", Old: "v1", New: "v2"},
+	}, change.Fields)
+
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected change: %+v", change)
+	default:
+	}
+}
+
+func TestWatchBootstrapConfigRetry(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	v1 := "v1"
+	srv.SetBootstrapConfig(cluster_api.BootstrapConfig{DatabrokerStorageConnection: &v1})
+	srv.InjectError("GetClusterBootstrapConfig", http.StatusInternalServerError, 2)
+
+	api := newTestAPI(t, srv, zerosdk.WithRetryPolicy(zerosdk.NoRetry))
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	go func() { _ = api.Connect(ctx) }()
+
+	changes := make(chan zerosdk.BootstrapConfigChange, 16)
+	go func() {
+		_ = api.WatchBootstrapConfig(ctx, func(_ context.Context, change zerosdk.BootstrapConfigChange) {
+			changes <- change
+		})
+	}()
+
+	// the failed fetch is retried without waiting for another event
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for bootstrap config change")
+	case change := <-changes:
+		assert.Equal(t, &cluster_api.BootstrapConfig{DatabrokerStorageConnection: &v1}, change.New)
+	}
+	assert.Equal(t, 3, srv.RequestCount("GetClusterBootstrapConfig"))
+}
@@ -0,0 +1,405 @@
+package zerosdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bundleCacheEntrySuffix = ".json"
+	bundleCacheBodySuffix  = ".bundle"
+	bundleCacheTempPattern = "download-*"
+)
+
+var (
+	// ErrBundleNotCached is returned when the bundle is not present in the cache
+	ErrBundleNotCached = errors.New("bundle is not cached")
+	// ErrBundleCacheCorrupted is returned when the cached bundle body does not match its recorded digest
+	ErrBundleCacheCorrupted = errors.New("cached bundle is corrupted")
+)
+
+// BundleCache is a persistent on-disk cache of downloaded bundles.
+// Along with the bundle body it keeps the conditional and metadata of the download,
+// so that after a restart the bundles are only downloaded again if they were changed.
+//
+// Each bundle is stored as a body file named after its content digest, and an entry file that references it.
+// The entry file is replaced atomically after the body is written, so that a crash at any point
+// leaves either the previous or the new version of the bundle in the cache.
+type BundleCache struct {
+	dir string
+	mx  sync.Mutex
+	// verified holds the state of the bundle bodies when they were last verified, by bundle ID
+	verified map[string]bodyState
+}
+
+// bodyState identifies the version of a bundle body file, so that it is only verified again once it changed
+type bodyState struct {
+	sha256  string
+	size    int64
+	modTime time.Time
+}
+
+func (s bodyState) equal(other bodyState) bool {
+	return s.sha256 == other.sha256 && s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+// BundleCacheEntry describes a cached bundle
+type BundleCacheEntry struct {
+	// BundleID is the ID of the bundle
+	BundleID string `json:"bundleId"`
+	// DownloadConditional is the conditional to use for the subsequent downloads of the bundle
+	*DownloadConditional `json:"conditional"`
+	// Metadata is the metadata captured when the bundle was downloaded
+	Metadata map[string]string `json:"metadata"`
+	// SHA256 is the hex encoded digest of the bundle body
+	SHA256 string `json:"sha256"`
+	// Size is the size of the bundle body
+	Size int64 `json:"size"`
+	// UpdatedAt is the time the bundle was downloaded
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// NewBundleCache creates a bundle cache in the given directory, creating the directory if necessary.
+// The directory should not be shared with other caches, as leftovers of the interrupted downloads are removed.
+func NewBundleCache(dir string) (*BundleCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+
+	for _, pattern := range []string{bundleCacheTempPattern, "*" + bundleCacheEntrySuffix + ".tmp-*"} {
+		paths, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("list cache dir: %w", err)
+		}
+		for _, p := range paths {
+			if err := os.Remove(p); err != nil {
+				return nil, fmt.Errorf("remove leftover file: %w", err)
+			}
+		}
+	}
+
+	return &BundleCache{dir: dir, verified: make(map[string]bodyState)}, nil
+}
+
+// Get returns the cache entry of the bundle, or ErrBundleNotCached
+func (c *BundleCache) Get(id string) (*BundleCacheEntry, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.readEntry(c.entryPath(id))
+}
+
+// Open returns the body of the cached bundle, or ErrBundleNotCached
+func (c *BundleCache) Open(id string) (io.ReadCloser, *BundleCacheEntry, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	entry, err := c.readEntry(c.entryPath(id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fd, err := os.Open(c.bodyPath(id, entry.SHA256))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("%w: body is missing", ErrBundleCacheCorrupted)
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("open bundle body: %w", err)
+	}
+	return fd, entry, nil
+}
+
+// Verify checks that the cached bundle body matches the digest recorded when it was downloaded.
+// Unlike Download, that only verifies the body once it changed on disk, it always reads the whole body.
+func (c *BundleCache) Verify(id string) error {
+	r, entry, err := c.Open(id)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return fmt.Errorf("read bundle body: %w", err)
+	}
+	if size != entry.Size || hex.EncodeToString(h.Sum(nil)) != entry.SHA256 {
+		return ErrBundleCacheCorrupted
+	}
+	return nil
+}
+
+// List returns all cached bundle entries
+func (c *BundleCache) List() ([]*BundleCacheEntry, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*"+bundleCacheEntrySuffix))
+	if err != nil {
+		return nil, fmt.Errorf("list cache dir: %w", err)
+	}
+
+	entries := make([]*BundleCacheEntry, 0, len(paths))
+	for _, p := range paths {
+		entry, err := c.readEntry(p)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Remove evicts the bundle from the cache
+func (c *BundleCache) Remove(id string) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	err := os.Remove(c.entryPath(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove entry: %w", err)
+	}
+	delete(c.verified, id)
+	return c.removeBodies(id, "")
+}
+
+// Prune evicts all bundles for which keep returns false
+func (c *BundleCache) Prune(keep func(*BundleCacheEntry) bool) error {
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if keep(entry) {
+			continue
+		}
+		if err := c.Remove(entry.BundleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download downloads the bundle into the cache, unless the cached version is up to date.
+// It returns the cache entry and whether the bundle was updated.
+// If the cached body fails the integrity check, the bundle is downloaded again unconditionally.
+// The body is only checked the first time, and whenever its size or modification time changed since.
+func (c *BundleCache) Download(ctx context.Context, api *API, id string) (*BundleCacheEntry, bool, error) {
+	current, err := c.Get(id)
+	if err != nil && !errors.Is(err, ErrBundleNotCached) {
+		return nil, false, err
+	}
+
+	var conditional *DownloadConditional
+	if current != nil && c.verifyChanged(current) == nil {
+		conditional = current.DownloadConditional
+	}
+
+	fd, err := os.CreateTemp(c.dir, bundleCacheTempPattern)
+	if err != nil {
+		return nil, false, fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		_ = fd.Close()
+		_ = os.Remove(fd.Name())
+	}()
+
+	h := sha256.New()
+	w := &countingWriter{w: io.MultiWriter(fd, h)}
+	result, err := api.DownloadClusterResourceBundle(ctx, w, id, conditional)
+	if err != nil {
+		return nil, false, err
+	}
+	if result.NotModified {
+		return current, false, nil
+	}
+
+	entry := &BundleCacheEntry{
+		BundleID:            id,
+		DownloadConditional: result.DownloadConditional,
+		Metadata:            result.Metadata,
+		SHA256:              hex.EncodeToString(h.Sum(nil)),
+		Size:                w.n,
+		UpdatedAt:           api.cfg.clock.Now().UTC(),
+	}
+	if err := c.commit(fd, entry); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// verifyChanged verifies the cached bundle body, unless it was verified already and did not change since
+func (c *BundleCache) verifyChanged(entry *BundleCacheEntry) error {
+	state, err := c.bodyState(entry)
+	if err != nil {
+		return err
+	}
+	if state.size != entry.Size {
+		return ErrBundleCacheCorrupted
+	}
+
+	c.mx.Lock()
+	verified, ok := c.verified[entry.BundleID]
+	c.mx.Unlock()
+	if ok && verified.equal(state) {
+		return nil
+	}
+
+	if err := c.Verify(entry.BundleID); err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	c.verified[entry.BundleID] = state
+	c.mx.Unlock()
+	return nil
+}
+
+func (c *BundleCache) bodyState(entry *BundleCacheEntry) (bodyState, error) {
+	fi, err := os.Stat(c.bodyPath(entry.BundleID, entry.SHA256))
+	if errors.Is(err, os.ErrNotExist) {
+		return bodyState{}, fmt.Errorf("%w: body is missing", ErrBundleCacheCorrupted)
+	} else if err != nil {
+		return bodyState{}, fmt.Errorf("stat bundle body: %w", err)
+	}
+	return bodyState{sha256: entry.SHA256, size: fi.Size(), modTime: fi.ModTime()}, nil
+}
+
+// commit moves the downloaded body into place and atomically replaces the bundle entry
+func (c *BundleCache) commit(fd *os.File, entry *BundleCacheEntry) error {
+	if err := fd.Sync(); err != nil {
+		return fmt.Errorf("sync bundle body: %w", err)
+	}
+	if err := fd.Close(); err != nil {
+		return fmt.Errorf("close bundle body: %w", err)
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if err := os.Rename(fd.Name(), c.bodyPath(entry.BundleID, entry.SHA256)); err != nil {
+		return fmt.Errorf("rename bundle body: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %w", err)
+	}
+	if err := writeFileAtomic(c.entryPath(entry.BundleID), data); err != nil {
+		return fmt.Errorf("write entry: %w", err)
+	}
+
+	// the body was hashed as it was downloaded
+	if state, err := c.bodyState(entry); err == nil {
+		c.verified[entry.BundleID] = state
+	} else {
+		delete(c.verified, entry.BundleID)
+	}
+
+	return c.removeBodies(entry.BundleID, entry.SHA256)
+}
+
+func (c *BundleCache) readEntry(path string) (*BundleCacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBundleNotCached
+	} else if err != nil {
+		return nil, fmt.Errorf("read entry: %w", err)
+	}
+
+	var entry BundleCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBundleCacheCorrupted, err)
+	}
+	return &entry, nil
+}
+
+// removeBodies removes the body files of the bundle, except the one with the given digest
+func (c *BundleCache) removeBodies(id, keepSHA256 string) error {
+	prefix := c.key(id) + "-"
+	paths, err := filepath.Glob(filepath.Join(c.dir, prefix+"*"+bundleCacheBodySuffix))
+	if err != nil {
+		return fmt.Errorf("list bundle bodies: %w", err)
+	}
+	for _, p := range paths {
+		digest := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(p), prefix), bundleCacheBodySuffix)
+		if digest == keepSHA256 {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove bundle body: %w", err)
+		}
+	}
+	return nil
+}
+
+// key returns a file name safe key for the bundle ID
+func (c *BundleCache) key(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (c *BundleCache) entryPath(id string) string {
+	return filepath.Join(c.dir, c.key(id)+bundleCacheEntrySuffix)
+}
+
+func (c *BundleCache) bodyPath(id, digest string) string {
+	return filepath.Join(c.dir, c.key(id)+"-"+digest+bundleCacheBodySuffix)
+}
+
+// writeFileAtomic writes the file via a temporary file in the same directory,
+// that is synced and renamed over the destination
+func writeFileAtomic(path string, data []byte) error {
+	fd, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(fd.Name()) }()
+
+	if _, err := fd.Write(data); err != nil {
+		_ = fd.Close()
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		_ = fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(fd.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes the directory entries changes durable
+func syncDir(dir string) error {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	return fd.Sync()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
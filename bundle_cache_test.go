@@ -0,0 +1,117 @@
+package zerosdk_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func TestBundleCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("v1"), zerotest.WithBundleMetadata(map[string]string{"X-Version": "1"}))
+
+	api := newTestAPI(t, srv)
+
+	dir := t.TempDir()
+	cache, err := zerosdk.NewBundleCache(dir)
+	require.NoError(t, err)
+
+	_, err = cache.Get("config")
+	assert.ErrorIs(t, err, zerosdk.ErrBundleNotCached)
+
+	entry, updated, err := cache.Download(ctx, api, "config")
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, map[string]string{"X-Version": "1"}, entry.Metadata)
+	assert.EqualValues(t, 2, entry.Size)
+
+	readBody := func(t *testing.T, cache *zerosdk.BundleCache) string {
+		t.Helper()
+		r, _, err := cache.Open("config")
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "v1", readBody(t, cache))
+
+	t.Run("not modified after restart", func(t *testing.T) {
+		cache, err := zerosdk.NewBundleCache(dir)
+		require.NoError(t, err)
+
+		got, updated, err := cache.Download(ctx, api, "config")
+		require.NoError(t, err)
+		assert.False(t, updated)
+		assert.Equal(t, entry.DownloadConditional, got.DownloadConditional)
+		assert.NoError(t, cache.Verify("config"))
+	})
+
+	t.Run("updated", func(t *testing.T) {
+		srv.SetBundle("config", []byte("v2"))
+		_, updated, err := cache.Download(ctx, api, "config")
+		require.NoError(t, err)
+		assert.True(t, updated)
+		assert.Equal(t, "v2", readBody(t, cache))
+
+		bodies, err := filepath.Glob(filepath.Join(dir, "*.bundle"))
+		require.NoError(t, err)
+		assert.Len(t, bodies, 1, "previous body should be removed")
+	})
+
+	t.Run("verified once", func(t *testing.T) {
+		bodies, err := filepath.Glob(filepath.Join(dir, "*.bundle"))
+		require.NoError(t, err)
+		require.Len(t, bodies, 1)
+		fi, err := os.Stat(bodies[0])
+		require.NoError(t, err)
+
+		// the body is not read again unless its size or modification time changed
+		require.NoError(t, os.WriteFile(bodies[0], []byte("xx"), 0o600))
+		require.NoError(t, os.Chtimes(bodies[0], fi.ModTime(), fi.ModTime()))
+		_, updated, err := cache.Download(ctx, api, "config")
+		require.NoError(t, err)
+		assert.False(t, updated)
+		assert.ErrorIs(t, cache.Verify("config"), zerosdk.ErrBundleCacheCorrupted, "explicit verification should read the body")
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		bodies, err := filepath.Glob(filepath.Join(dir, "*.bundle"))
+		require.NoError(t, err)
+		require.Len(t, bodies, 1)
+		require.NoError(t, os.WriteFile(bodies[0], []byte("xx"), 0o600))
+		require.NoError(t, os.Chtimes(bodies[0], time.Now(), time.Now().Add(time.Second)))
+		assert.ErrorIs(t, cache.Verify("config"), zerosdk.ErrBundleCacheCorrupted)
+
+		_, updated, err := cache.Download(ctx, api, "config")
+		require.NoError(t, err)
+		assert.True(t, updated, "corrupted bundle should be downloaded again")
+		assert.NoError(t, cache.Verify("config"))
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		entries, err := cache.List()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "config", entries[0].BundleID)
+
+		require.NoError(t, cache.Prune(func(e *zerosdk.BundleCacheEntry) bool { return e.BundleID != "config" }))
+		_, err = cache.Get("config")
+		assert.ErrorIs(t, err, zerosdk.ErrBundleNotCached)
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+}
@@ -0,0 +1,111 @@
+package zerosdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxBundleRecordSize limits the size of a single bundle record
+const maxBundleRecordSize = 64 << 20 // 64mb
+
+// ErrMalformedRecord is returned by the RecordReader when the bundle cannot be decoded
+var ErrMalformedRecord = errors.New("malformed bundle record")
+
+// BundleDecoder splits the bundle into records, see OpenClusterResourceBundle
+type BundleDecoder interface {
+	// NewRecordReader returns the reader of the records of the bundle body
+	NewRecordReader(r io.Reader) RecordReader
+}
+
+// RecordReader reads the bundle records one by one
+type RecordReader interface {
+	// ReadRecord returns the next record, that is only valid until the next call,
+	// or io.EOF once there are no more records.
+	ReadRecord() ([]byte, error)
+}
+
+// BundleDecoderFunc is a function that implements BundleDecoder
+type BundleDecoderFunc func(r io.Reader) RecordReader
+
+// NewRecordReader implements BundleDecoder
+func (f BundleDecoderFunc) NewRecordReader(r io.Reader) RecordReader {
+	return f(r)
+}
+
+// ProtoDelimitedDecoder decodes the bundles of protobuf messages, each prefixed with its varint encoded size,
+// as written by protodelim.MarshalTo. The records are the marshaled messages.
+var ProtoDelimitedDecoder BundleDecoder = BundleDecoderFunc(func(r io.Reader) RecordReader {
+	return &protoDelimitedReader{r: bufio.NewReader(r)}
+})
+
+type protoDelimitedReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// ReadRecord implements RecordReader
+func (r *protoDelimitedReader) ReadRecord() ([]byte, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: read size: %v", ErrMalformedRecord, err)
+	}
+	if size > maxBundleRecordSize {
+		return nil, fmt.Errorf("%w: record size %d exceeds %d", ErrMalformedRecord, size, maxBundleRecordSize)
+	}
+
+	if uint64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	if _, err := io.ReadFull(r.r, r.buf); errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: truncated record", ErrMalformedRecord)
+	} else if err != nil {
+		return nil, err
+	}
+	return r.buf, nil
+}
+
+// JSONLinesDecoder decodes the bundles of newline delimited JSON values, the empty lines are skipped.
+// The records are the JSON values.
+var JSONLinesDecoder BundleDecoder = BundleDecoderFunc(func(r io.Reader) RecordReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxBundleRecordSize)
+	return &jsonLinesReader{s: s}
+})
+
+type jsonLinesReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// ReadRecord implements RecordReader
+func (r *jsonLinesReader) ReadRecord() ([]byte, error) {
+	for r.s.Scan() {
+		r.line++
+		record := bytes.TrimSpace(r.s.Bytes())
+		if len(record) == 0 {
+			continue
+		}
+		if !json.Valid(record) {
+			return nil, fmt.Errorf("%w: line %d is not valid JSON", ErrMalformedRecord, r.line)
+		}
+		return record, nil
+	}
+
+	err := r.s.Err()
+	switch {
+	case err == nil:
+		return nil, io.EOF
+	case errors.Is(err, bufio.ErrTooLong):
+		return nil, fmt.Errorf("%w: line %d exceeds %d bytes", ErrMalformedRecord, r.line+1, maxBundleRecordSize)
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,162 @@
+package zerosdk_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/apierror"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func TestBundleDecoders(t *testing.T) {
+	t.Parallel()
+
+	readAll := func(d zerosdk.BundleDecoder, data []byte) ([]string, error) {
+		r := d.NewRecordReader(bytes.NewReader(data))
+		var records []string
+		for {
+			record, err := r.ReadRecord()
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			} else if err != nil {
+				return records, err
+			}
+			records = append(records, string(record))
+		}
+	}
+
+	t.Run("proto delimited", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		for _, v := range []string{"a", "", strings.Repeat("b", 1000)} {
+			_, err := protodelim.MarshalTo(&buf, wrapperspb.String(v))
+			require.NoError(t, err)
+		}
+
+		records, err := readAll(zerosdk.ProtoDelimitedDecoder, buf.Bytes())
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		var msg wrapperspb.StringValue
+		require.NoError(t, proto.Unmarshal([]byte(records[2]), &msg))
+		assert.Equal(t, strings.Repeat("b", 1000), msg.Value)
+
+		_, err = readAll(zerosdk.ProtoDelimitedDecoder, buf.Bytes()[:buf.Len()-1])
+		assert.ErrorIs(t, err, zerosdk.ErrMalformedRecord, "truncated")
+		_, err = readAll(zerosdk.ProtoDelimitedDecoder, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+		assert.ErrorIs(t, err, zerosdk.ErrMalformedRecord, "too large")
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		t.Parallel()
+
+		records, err := readAll(zerosdk.JSONLinesDecoder, []byte("{\"a\":1}\n\n  [1, 2]  \r\n\"s\""))
+		require.NoError(t, err)
+		assert.Equal(t, []string{`{"a":1}`, `[1, 2]`, `"s"`}, records)
+
+		_, err = readAll(zerosdk.JSONLinesDecoder, []byte("{\"a\":1}\n{\"a\":"))
+		assert.ErrorIs(t, err, zerosdk.ErrMalformedRecord)
+		assert.ErrorContains(t, err, "line 2")
+	})
+}
+
+func TestOpenBundle(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("{\"a\":1}\n{\"b\":2}\n"), zerotest.WithBundleZstd())
+	srv.SetBundle("malformed", []byte("{\"a\":1}\nnot json\n"))
+
+	api := newTestAPI(t, srv)
+
+	readAll := func(it *zerosdk.BundleIterator) []string {
+		t.Helper()
+		defer it.Close()
+
+		var records []string
+		for it.Next() {
+			records = append(records, string(it.Record()))
+		}
+		return records
+	}
+
+	it := api.OpenClusterResourceBundle(ctx, "config", nil, zerosdk.JSONLinesDecoder)
+	assert.Equal(t, []string{`{"a":1}`, `{"b":2}`}, readAll(it))
+	require.NoError(t, it.Err())
+	result := it.Result()
+	require.NotNil(t, result)
+	assert.False(t, result.NotModified)
+
+	it = api.OpenClusterResourceBundle(ctx, "config", result.DownloadConditional, zerosdk.JSONLinesDecoder)
+	assert.Empty(t, readAll(it))
+	require.NoError(t, it.Err())
+	require.NotNil(t, it.Result())
+	assert.True(t, it.Result().NotModified)
+
+	it = api.OpenClusterResourceBundle(ctx, "malformed", nil, zerosdk.JSONLinesDecoder)
+	assert.Equal(t, []string{`{"a":1}`}, readAll(it))
+	assert.ErrorIs(t, it.Err(), zerosdk.ErrMalformedRecord)
+	assert.True(t, apierror.IsTerminalError(it.Err()))
+	var applyErr *zerosdk.ApplyError
+	require.True(t, errors.As(it.Err(), &applyErr))
+	assert.Equal(t, cluster_api.InvalidBundle, applyErr.Source)
+	assert.Nil(t, it.Result())
+
+	it = api.OpenClusterResourceBundle(ctx, "missing", nil, zerosdk.JSONLinesDecoder)
+	assert.Empty(t, readAll(it))
+	assert.Error(t, it.Err())
+	assert.NotErrorIs(t, it.Err(), zerosdk.ErrMalformedRecord)
+
+	// closing the iterator early stops the download
+	it = api.OpenClusterResourceBundle(ctx, "config", nil, zerosdk.JSONLinesDecoder)
+	require.True(t, it.Next())
+	require.NoError(t, it.Close())
+}
+
+func TestOpenBundleStreaming(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	first := "{\"a\":1}\n"
+	srv.SetBundle("config", []byte(first+"{\"b\":2}\n"))
+
+	api := newTestAPI(t, srv)
+
+	// the server stalls after sending the first record, until it was yielded by the iterator
+	yielded := make(chan struct{})
+	var streamed atomic.Bool
+	srv.InterruptDownloads("config", int64(len(first)), 1, func() {
+		select {
+		case <-yielded:
+			streamed.Store(true)
+		case <-time.After(time.Second * 5):
+		}
+	})
+
+	it := api.OpenClusterResourceBundle(ctx, "config", nil, zerosdk.JSONLinesDecoder)
+	defer it.Close()
+	require.True(t, it.Next())
+	assert.Equal(t, `{"a":1}`, string(it.Record()))
+	close(yielded)
+
+	require.True(t, it.Next())
+	assert.Equal(t, `{"b":2}`, string(it.Record()))
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+	assert.True(t, streamed.Load(), "the record should be yielded before the download completes")
+}
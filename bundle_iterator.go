@@ -0,0 +1,162 @@
+package zerosdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pomerium/zero-sdk/apierror"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+)
+
+// OpenClusterResourceBundle downloads the bundle and returns the iterator over its records,
+// that are decoded with given decoder while the bundle is being downloaded,
+// so that large bundles may be applied record by record without buffering them in memory.
+//
+// The bundle is only verified once it was downloaded completely, so the records are not to be committed
+// until Next returned false and Err returned nil. The malformed bundles are reported by Err
+// as a terminal ApplyError with the invalid_bundle source.
+// The iterator must be closed, that cancels the download if it is still in progress.
+func (api *API) OpenClusterResourceBundle(
+	ctx context.Context,
+	id string,
+	current *DownloadConditional,
+	decoder BundleDecoder,
+	opts ...DownloadOption,
+) *BundleIterator {
+	ctx, cancel := context.WithCancelCause(ctx)
+	pr, pw := io.Pipe()
+	it := &BundleIterator{
+		id:     id,
+		cancel: cancel,
+		src:    &sourceReader{r: pr},
+		body:   pr,
+		done:   make(chan struct{}),
+	}
+	it.records = decoder.NewRecordReader(it.src)
+
+	go func() {
+		defer close(it.done)
+
+		// not shared with the concurrent downloads, as these are only served once complete
+		it.result, it.downloadErr = api.downloadClusterResourceBundle(ctx, pw, id, current, newDownloadConfig(opts...))
+		_ = pw.CloseWithError(it.downloadErr)
+	}()
+	return it
+}
+
+// BundleIterator iterates over the records of a bundle, see OpenClusterResourceBundle.
+//
+//	it := api.OpenClusterResourceBundle(ctx, id, nil, zerosdk.JSONLinesDecoder)
+//	defer it.Close()
+//	for it.Next() {
+//		apply(it.Record())
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type BundleIterator struct {
+	id      string
+	cancel  context.CancelCauseFunc
+	src     *sourceReader
+	body    *io.PipeReader
+	records RecordReader
+
+	record []byte
+	count  int
+	err    error
+
+	// set once done is closed
+	done        chan struct{}
+	result      *DownloadResult
+	downloadErr error
+	closeOnce   sync.Once
+}
+
+// Next advances the iterator to the next record, it returns false once there are no more records or on error.
+func (it *BundleIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	record, err := it.records.ReadRecord()
+	if err == nil {
+		it.record = record
+		it.count++
+		return true
+	}
+
+	it.record = nil
+	switch {
+	case it.src.err != nil:
+		// the download failed
+		it.err = it.src.err
+	case errors.Is(err, io.EOF):
+		// the download completes once the rest of the body, if any, is read
+		if _, err := io.Copy(io.Discard, it.src); err != nil {
+			it.err = err
+			break
+		}
+		<-it.done
+		it.err = it.downloadErr
+	case errors.Is(err, ErrMalformedRecord):
+		it.err = NewApplyError(cluster_api.InvalidBundle,
+			apierror.NewTerminalError(fmt.Errorf("bundle %s record %d: %w", it.id, it.count+1, err)))
+	default:
+		it.err = NewApplyError(cluster_api.InvalidBundle, fmt.Errorf("decode bundle: %w", err))
+	}
+	if it.err == nil {
+		it.err = io.EOF
+	}
+	return false
+}
+
+// Record returns the current record, that is only valid until the next call to Next
+func (it *BundleIterator) Record() []byte {
+	return it.record
+}
+
+// Err returns the error that stopped the iteration, nil if all records were read
+func (it *BundleIterator) Err() error {
+	if errors.Is(it.err, io.EOF) {
+		return nil
+	}
+	return it.err
+}
+
+// Result returns the download result once the iteration completed without error,
+// i.e. to check whether the bundle was not modified and to record its conditional.
+func (it *BundleIterator) Result() *DownloadResult {
+	if it.Err() != nil || it.err == nil {
+		return nil
+	}
+	return it.result
+}
+
+// Close stops the download if it is still in progress, and waits for it to complete
+func (it *BundleIterator) Close() error {
+	it.closeOnce.Do(func() {
+		it.cancel(errors.New("bundle iterator closed"))
+		_ = it.body.Close()
+		<-it.done
+	})
+	return nil
+}
+
+// sourceReader records the error of the underlying reader,
+// to tell the download errors apart from the decoding ones
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read implements io.Reader
+func (r *sourceReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+	return n, err
+}
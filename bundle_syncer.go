@@ -0,0 +1,415 @@
+package zerosdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/pomerium/zero-sdk/apierror"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	connect_mux "github.com/pomerium/zero-sdk/connect-mux"
+)
+
+const (
+	defaultBundleSyncInitialRetryInterval = time.Second
+	defaultBundleSyncMaxRetryInterval     = time.Minute * 5
+)
+
+// BundleApplier applies the downloaded resource bundles
+type BundleApplier interface {
+	// ApplyBundle is called with the body of a bundle that was changed since it was last applied.
+	// To indicate the failure source that should be reported to the cloud, wrap the error with NewApplyError,
+	// otherwise the failure is reported as unknown_error.
+	ApplyBundle(ctx context.Context, bundleID string, body io.Reader, metadata map[string]string) error
+}
+
+// BundleApplierFunc is a function that implements BundleApplier
+type BundleApplierFunc func(ctx context.Context, bundleID string, body io.Reader, metadata map[string]string) error
+
+// ApplyBundle implements BundleApplier
+func (f BundleApplierFunc) ApplyBundle(ctx context.Context, bundleID string, body io.Reader, metadata map[string]string) error {
+	return f(ctx, bundleID, body, metadata)
+}
+
+// ApplyError is an error that carries the failure source to be reported to the cloud
+type ApplyError struct {
+	Source cluster_api.BundleStatusFailureSource
+	Err    error
+}
+
+// NewApplyError creates a new ApplyError
+func NewApplyError(source cluster_api.BundleStatusFailureSource, err error) *ApplyError {
+	return &ApplyError{Source: source, Err: err}
+}
+
+// Error implements error for ApplyError
+func (e *ApplyError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap implements errors.Unwrap for ApplyError
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// BundleSyncerOption configures a BundleSyncer
+type BundleSyncerOption func(*bundleSyncerConfig)
+
+type bundleSyncerConfig struct {
+	tempDir              string
+	initialRetryInterval time.Duration
+	maxRetryInterval     time.Duration
+	downloadOptions      []DownloadOption
+}
+
+// WithBundleSyncTempDir sets the directory where bundles are downloaded to before being applied.
+// By default, os.TempDir is used.
+func WithBundleSyncTempDir(dir string) BundleSyncerOption {
+	return func(cfg *bundleSyncerConfig) {
+		cfg.tempDir = dir
+	}
+}
+
+// WithBundleSyncRetryInterval sets the initial and max interval between the retries of a failed sync
+func WithBundleSyncRetryInterval(initial, max time.Duration) BundleSyncerOption {
+	return func(cfg *bundleSyncerConfig) {
+		cfg.initialRetryInterval = initial
+		cfg.maxRetryInterval = max
+	}
+}
+
+// WithBundleSyncDownloadOptions sets the options the bundles are downloaded with, i.e. the bandwidth limit
+func WithBundleSyncDownloadOptions(opts ...DownloadOption) BundleSyncerOption {
+	return func(cfg *bundleSyncerConfig) {
+		cfg.downloadOptions = opts
+	}
+}
+
+// BundleSyncer keeps the cluster resource bundles in sync with the cloud.
+// It reconciles all bundles when the connection to the cloud is established,
+// whenever a bundle update is received, and retries failed bundles with a backoff.
+// Bundles that failed with a terminal error are skipped until they are updated.
+type BundleSyncer struct {
+	api     *API
+	applier BundleApplier
+	cfg     bundleSyncerConfig
+	trigger chan struct{}
+
+	mx      sync.Mutex
+	applied map[string]*DownloadConditional
+	// failed holds the conditionals of the bundles that failed with a terminal error,
+	// nil if the failed bundle is not known, that is then skipped until its update is received
+	failed map[string]*DownloadConditional
+	// unreported holds the metadata of the applied bundles, which success failed to be reported
+	unreported map[string]map[string]string
+}
+
+// NewBundleSyncer creates a new BundleSyncer
+func NewBundleSyncer(api *API, applier BundleApplier, opts ...BundleSyncerOption) *BundleSyncer {
+	cfg := bundleSyncerConfig{
+		initialRetryInterval: defaultBundleSyncInitialRetryInterval,
+		maxRetryInterval:     defaultBundleSyncMaxRetryInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &BundleSyncer{
+		api:        api,
+		applier:    applier,
+		cfg:        cfg,
+		trigger:    make(chan struct{}, 1),
+		applied:    make(map[string]*DownloadConditional),
+		failed:     make(map[string]*DownloadConditional),
+		unreported: make(map[string]map[string]string),
+	}
+}
+
+// Run syncs the bundles until the context is canceled.
+// The API must be connected (see API.Connect) for the syncer to receive updates.
+func (s *BundleSyncer) Run(ctx context.Context) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return s.api.Watch(ctx,
+			connect_mux.WithOnConnected(func(_ context.Context) {
+				// the updates of the failed bundles may have been missed while disconnected
+				s.forgetFailed(func(_ string, c *DownloadConditional) bool { return c == nil })
+				s.Trigger()
+			}),
+			connect_mux.WithOnBundleUpdated(func(_ context.Context, bundleID string) {
+				s.forgetFailed(func(id string, _ *DownloadConditional) bool { return id == bundleID })
+				s.Trigger()
+			}),
+		)
+	})
+	eg.Go(func() error {
+		return s.reconcileLoop(ctx)
+	})
+	return eg.Wait()
+}
+
+// Trigger requests the bundles to be reconciled
+func (s *BundleSyncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *BundleSyncer) reconcileLoop(ctx context.Context) error {
+	bo := backoff.NewExponentialBackOff()
+	bo.InitialInterval = s.cfg.initialRetryInterval
+	bo.MaxInterval = s.cfg.maxRetryInterval
+	bo.MaxElapsedTime = 0
+	bo.Clock = s.api.cfg.clock
+	bo.Reset()
+
+	retry := s.api.cfg.clock.NewTimer(0)
+	if !retry.Stop() {
+		<-retry.C()
+	}
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.trigger:
+		case <-retry.C():
+		}
+
+		if !retry.Stop() {
+			select {
+			case <-retry.C():
+			default:
+			}
+		}
+
+		err := s.reconcile(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			bo.Reset()
+			continue
+		}
+
+		s.api.logger.Warn().Err(err).Msg("bundle sync failed, will retry")
+		retry.Reset(bo.NextBackOff())
+	}
+}
+
+// reconcile syncs all bundles, and returns an error if any of the bundles should be retried.
+// Bundles that failed with a terminal error are not retried until they are updated.
+func (s *BundleSyncer) reconcile(ctx context.Context) error {
+	resp, err := s.api.GetClusterResourceBundles(ctx)
+	if err != nil {
+		return fmt.Errorf("get bundles: %w", err)
+	}
+
+	s.forgetRemoved(resp.Bundles)
+
+	var retry error
+	for _, b := range resp.Bundles {
+		err := s.syncBundle(ctx, b.Id)
+		if err == nil {
+			continue
+		}
+		if apierror.IsTerminalError(err) {
+			s.api.logger.Error().Err(err).Str("bundle_id", b.Id).Msg("bundle sync failed")
+			continue
+		}
+		retry = multierror.Append(retry, fmt.Errorf("bundle %s: %w", b.Id, err))
+	}
+	return retry
+}
+
+func (s *BundleSyncer) forgetRemoved(bundles []cluster_api.Bundle) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	current := make(map[string]struct{}, len(bundles))
+	for _, b := range bundles {
+		current[b.Id] = struct{}{}
+	}
+	for id := range s.applied {
+		if _, ok := current[id]; !ok {
+			delete(s.applied, id)
+		}
+	}
+	for id := range s.failed {
+		if _, ok := current[id]; !ok {
+			delete(s.failed, id)
+		}
+	}
+	for id := range s.unreported {
+		if _, ok := current[id]; !ok {
+			delete(s.unreported, id)
+		}
+	}
+}
+
+func (s *BundleSyncer) forgetFailed(match func(id string, conditional *DownloadConditional) bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for id, c := range s.failed {
+		if match(id, c) {
+			delete(s.failed, id)
+		}
+	}
+}
+
+// getCurrent returns the conditional of the bundle to download it with,
+// that is of the failed bundle if it failed, so that it is only downloaded again once updated.
+// skip is true if the bundle failed and it is not known how to tell whether it was updated.
+func (s *BundleSyncer) getCurrent(id string) (current *DownloadConditional, skip bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if c, failed := s.failed[id]; failed {
+		return c, c == nil
+	}
+	return s.applied[id], false
+}
+
+// setApplied marks the bundle applied, with its success pending to be reported
+func (s *BundleSyncer) setApplied(id string, conditional *DownloadConditional, metadata map[string]string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.applied[id] = conditional
+	s.unreported[id] = metadata
+	delete(s.failed, id)
+}
+
+func (s *BundleSyncer) setFailed(id string, conditional *DownloadConditional) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.failed[id] = conditional
+}
+
+// reportApplied reports the success of the applied bundle, unless it was already reported
+func (s *BundleSyncer) reportApplied(ctx context.Context, id string) error {
+	s.mx.Lock()
+	metadata, ok := s.unreported[id]
+	s.mx.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := s.api.ReportBundleAppliedSuccess(ctx, id, metadata); err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+
+	s.discardUnreported(id)
+	return nil
+}
+
+func (s *BundleSyncer) discardUnreported(id string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.unreported, id)
+}
+
+// syncBundle downloads the bundle if it was changed, applies it and reports the outcome
+func (s *BundleSyncer) syncBundle(ctx context.Context, id string) error {
+	current, skip := s.getCurrent(id)
+	if skip {
+		return nil
+	}
+
+	result, err := s.downloadAndApply(ctx, id, current)
+	if err == nil && result.NotModified {
+		// the success of the bundle applied earlier may have failed to be reported
+		return s.reportApplied(ctx, id)
+	}
+	if err == nil {
+		s.setApplied(id, result.DownloadConditional, result.Metadata)
+		return s.reportApplied(ctx, id)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// the bundle changed since it was applied, so its success is not to be reported anymore
+	s.discardUnreported(id)
+	if apierror.IsTerminalError(err) {
+		s.setFailed(id, failedConditional(result, err))
+	}
+
+	reportErr := s.api.ReportBundleAppliedFailure(ctx, id, bundleFailureSource(err), err)
+	if reportErr != nil {
+		return multierror.Append(err, reportErr)
+	}
+	return err
+}
+
+// downloadAndApply downloads the bundle if it differs from current, and applies it.
+// The result is also returned if the bundle was downloaded, but failed to apply.
+func (s *BundleSyncer) downloadAndApply(ctx context.Context, id string, current *DownloadConditional) (*DownloadResult, error) {
+	fd, err := os.CreateTemp(s.cfg.tempDir, "bundle-*")
+	if err != nil {
+		return nil, NewApplyError(cluster_api.IoError, fmt.Errorf("create temp file: %w", err))
+	}
+	defer func() {
+		_ = fd.Close()
+		_ = os.Remove(fd.Name())
+	}()
+
+	opts := append([]DownloadOption{withDownloadTempDir(s.cfg.tempDir)}, s.cfg.downloadOptions...)
+	result, err := s.api.DownloadClusterResourceBundle(ctx, fd, id, current, opts...)
+	if err != nil {
+		// keep the source of the classified errors, i.e. the checksum mismatch
+		var applyErr *ApplyError
+		if errors.As(err, &applyErr) {
+			return nil, fmt.Errorf("download: %w", err)
+		}
+		// the non-retryable DownloadError is terminal by itself
+		return nil, NewApplyError(cluster_api.DownloadError, fmt.Errorf("download: %w", err))
+	}
+	if result.NotModified {
+		return result, nil
+	}
+
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return nil, NewApplyError(cluster_api.IoError, fmt.Errorf("seek temp file: %w", err))
+	}
+
+	err = s.applier.ApplyBundle(ctx, id, fd, result.Metadata)
+	if err != nil {
+		return result, fmt.Errorf("apply: %w", err)
+	}
+	return result, nil
+}
+
+// failedConditional returns the conditional of the bundle that failed to sync, nil if it is not known
+func failedConditional(result *DownloadResult, err error) *DownloadConditional {
+	if result != nil {
+		return result.DownloadConditional
+	}
+	var rejected *rejectedBundleError
+	if errors.As(err, &rejected) {
+		return rejected.conditional
+	}
+	return nil
+}
+
+// bundleFailureSource returns the failure source to report for the error
+func bundleFailureSource(err error) cluster_api.BundleStatusFailureSource {
+	var applyErr *ApplyError
+	if errors.As(err, &applyErr) {
+		return applyErr.Source
+	}
+	return cluster_api.UnknownError
+}
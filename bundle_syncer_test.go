@@ -0,0 +1,208 @@
+package zerosdk_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/apierror"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func TestBundleSyncer(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("v1"), zerotest.WithBundleMetadata(map[string]string{"X-Version": "1"}))
+
+	api := newTestAPI(t, srv)
+
+	type applied struct {
+		id, body string
+	}
+	appliedCh := make(chan applied, 16)
+	failNext := make(chan error, 1)
+	applier := zerosdk.BundleApplierFunc(func(_ context.Context, id string, body io.Reader, _ map[string]string) error {
+		select {
+		case err := <-failNext:
+			return err
+		default:
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		appliedCh <- applied{id, string(data)}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	go func() { _ = api.Connect(ctx) }()
+
+	syncer := zerosdk.NewBundleSyncer(api, applier,
+		zerosdk.WithBundleSyncTempDir(t.TempDir()),
+		zerosdk.WithBundleSyncRetryInterval(time.Millisecond*10, time.Millisecond*100),
+	)
+	go func() { _ = syncer.Run(ctx) }()
+
+	next := func() applied {
+		t.Helper()
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for bundle to be applied")
+			return applied{}
+		case a := <-appliedCh:
+			return a
+		}
+	}
+
+	assert.Equal(t, applied{"config", "v1"}, next())
+	require.Eventually(t, func() bool { return len(srv.BundleStatuses("config")) == 1 }, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, map[string]string{"X-Version": "1"}, srv.BundleStatuses("config")[0].Success.Metadata)
+
+	// bundle is not modified, so it should not be applied again
+	syncer.Trigger()
+	srv.SetBundle("other", []byte("other-v1"))
+	syncer.Trigger()
+	assert.Equal(t, applied{"other", "other-v1"}, next())
+
+	// applier failure is reported, and the bundle is retried
+	failNext <- zerosdk.NewApplyError(cluster_api.DatabrokerError, errors.New("databroker unavailable"))
+	srv.SetBundle("config", []byte("v2"))
+	syncer.Trigger()
+	assert.Equal(t, applied{"config", "v2"}, next())
+
+	require.Eventually(t, func() bool { return len(srv.BundleStatuses("config")) == 3 }, time.Second*5, time.Millisecond*10)
+	statuses := srv.BundleStatuses("config")
+	require.NotNil(t, statuses[1].Failure)
+	assert.Equal(t, cluster_api.BundleStatusFailure{
+		Source:  cluster_api.DatabrokerError,
+		Message: "apply: databroker unavailable",
+	}, *statuses[1].Failure)
+	assert.NotNil(t, statuses[2].Success)
+
+	select {
+	case a := <-appliedCh:
+		t.Errorf("unexpected bundle applied: %v", a)
+	default:
+	}
+}
+
+func TestBundleSyncerTerminalFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("bad", []byte("bad"), zerotest.WithBundleChecksum("sha256:00"))
+	srv.SetBundle("config", []byte("v1"))
+
+	api := newTestAPI(t, srv)
+
+	var applies atomic.Int32
+	applier := zerosdk.BundleApplierFunc(func(_ context.Context, id string, body io.Reader, _ map[string]string) error {
+		if id == "config" {
+			applies.Add(1)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if string(data) == "v1" {
+			return zerosdk.NewApplyError(cluster_api.DatabrokerError, apierror.NewTerminalError(errors.New("invalid records")))
+		}
+		return nil
+	})
+	// the body is only read if the bundle is downloaded again
+	var reads atomic.Int32
+	progress := zerosdk.WithDownloadProgress(func(zerosdk.DownloadProgress) { reads.Add(1) })
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+
+	syncer := zerosdk.NewBundleSyncer(api, applier,
+		zerosdk.WithBundleSyncTempDir(t.TempDir()),
+		zerosdk.WithBundleSyncRetryInterval(time.Millisecond*10, time.Millisecond*100),
+		zerosdk.WithBundleSyncDownloadOptions(progress),
+	)
+	go func() { _ = syncer.Run(ctx) }()
+
+	// the bundles are synced in order, so the next one reported marks the end of the reconciliation
+	synced := func(barrier string) {
+		t.Helper()
+		srv.SetBundle(barrier, []byte(barrier))
+		syncer.Trigger()
+		require.Eventually(t, func() bool { return len(srv.BundleStatuses(barrier)) == 1 }, time.Second*5, time.Millisecond*10)
+	}
+
+	synced("x1")
+	require.Len(t, srv.BundleStatuses("bad"), 1)
+	assert.Equal(t, cluster_api.InvalidBundle, srv.BundleStatuses("bad")[0].Failure.Source)
+	require.Len(t, srv.BundleStatuses("config"), 1)
+	assert.Equal(t, cluster_api.DatabrokerError, srv.BundleStatuses("config")[0].Failure.Source)
+	assert.Equal(t, int32(1), applies.Load())
+	before := reads.Load()
+
+	// the failed bundles are not downloaded, applied or reported again until updated
+	synced("x2")
+	assert.Equal(t, before+1, reads.Load(), "only the barrier bundle should be downloaded")
+	assert.Equal(t, int32(1), applies.Load())
+	assert.Len(t, srv.BundleStatuses("bad"), 1)
+	assert.Len(t, srv.BundleStatuses("config"), 1)
+
+	srv.SetBundle("config", []byte("v2"))
+	synced("x3")
+	require.Len(t, srv.BundleStatuses("config"), 2)
+	assert.NotNil(t, srv.BundleStatuses("config")[1].Success)
+	assert.Len(t, srv.BundleStatuses("bad"), 1)
+}
+
+func TestBundleSyncerReportFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("v1"), zerotest.WithBundleMetadata(map[string]string{"X-Version": "1"}))
+	srv.InjectError("ReportClusterResourceBundleStatus", http.StatusInternalServerError, 2)
+
+	api := newTestAPI(t, srv)
+
+	var applies atomic.Int32
+	applier := zerosdk.BundleApplierFunc(func(_ context.Context, _ string, _ io.Reader, _ map[string]string) error {
+		applies.Add(1)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+
+	syncer := zerosdk.NewBundleSyncer(api, applier,
+		zerosdk.WithBundleSyncTempDir(t.TempDir()),
+		zerosdk.WithBundleSyncRetryInterval(time.Millisecond*10, time.Millisecond*100),
+	)
+	go func() { _ = syncer.Run(ctx) }()
+	syncer.Trigger()
+
+	// the success is reported once the report is retried, without applying the bundle again
+	require.Eventually(t, func() bool { return len(srv.BundleStatuses("config")) == 1 }, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, map[string]string{"X-Version": "1"}, srv.BundleStatuses("config")[0].Success.Metadata)
+	assert.Equal(t, 3, srv.RequestCount("ReportClusterResourceBundleStatus"))
+	assert.Equal(t, int32(1), applies.Load())
+
+	// and not reported again once it succeeded
+	syncer.Trigger()
+	srv.SetBundle("other", []byte("other"))
+	syncer.Trigger()
+	require.Eventually(t, func() bool { return len(srv.BundleStatuses("other")) == 1 }, time.Second*5, time.Millisecond*10)
+	assert.Len(t, srv.BundleStatuses("config"), 1)
+}
@@ -0,0 +1,92 @@
+// Package clock provides the time source used by the SDK, so that the time may be controlled in tests
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the current time and timers
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Since returns the time elapsed since t
+	Since(t time.Time) time.Duration
+	// Until returns the duration until t
+	Until(t time.Time) time.Duration
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+	// NewTimer creates a new Timer that sends the current time on its channel after at least duration d
+	NewTimer(d time.Duration) Timer
+	// NewTicker returns a new Ticker that sends the current time on its channel every period d
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc waits for the duration to elapse and then calls f in its own goroutine
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is the time.Timer of the Clock
+type Timer interface {
+	// C returns the channel the time is sent on, it is nil for the timers created by AfterFunc
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing, see time.Timer.Stop
+	Stop() bool
+	// Reset changes the timer to expire after duration d, see time.Timer.Reset
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the time.Ticker of the Clock
+type Ticker interface {
+	// C returns the channel the ticks are sent on
+	C() <-chan time.Time
+	// Stop turns off the ticker, see time.Ticker.Stop
+	Stop()
+	// Reset stops the ticker and resets its period to d, see time.Ticker.Reset
+	Reset(d time.Duration)
+}
+
+// Real returns the Clock backed by the time package
+func Real() Clock {
+	return realClock{}
+}
+
+// WithTimeout returns the context that is canceled once the clock timeout elapses.
+// Once the timeout elapses, context.Cause of the returned context is context.DeadlineExceeded.
+func WithTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := c.(realClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := c.AfterFunc(d, func() { cancel(context.DeadlineExceeded) })
+	return ctx, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Until(t time.Time) time.Duration        { return time.Until(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
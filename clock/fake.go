@@ -0,0 +1,235 @@
+package clock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is the Clock that only moves when advanced, so that the tests are deterministic
+type Fake struct {
+	mx      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	// changed is closed and replaced once a timer or ticker is started
+	changed chan struct{}
+}
+
+var _ Clock = (*Fake)(nil)
+
+// fakeWaiter is a timer or a ticker of the Fake clock
+type fakeWaiter struct {
+	clock *Fake
+	at    time.Time
+	// period is set for tickers
+	period time.Duration
+	c      chan time.Time
+	// f is set for the timers created by AfterFunc
+	f func()
+}
+
+// NewFake creates a new Fake clock set to the given time
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+// Now implements Clock
+func (f *Fake) Now() time.Time {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	return f.now
+}
+
+// Since implements Clock
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Until implements Clock
+func (f *Fake) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+// After implements Clock
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer implements Clock
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1)}
+	f.start(w, d)
+	return w
+}
+
+// NewTicker implements Clock
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{clock: f, period: d, c: make(chan time.Time, 1)}
+	f.start(w, d)
+	return fakeTicker{w}
+}
+
+// AfterFunc implements Clock
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &fakeWaiter{clock: f, f: fn}
+	f.start(w, d)
+	return w
+}
+
+// Advance moves the clock forward, firing the timers and tickers that are due
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to the given time, firing the timers and tickers that are due.
+// The clock never moves backwards.
+func (f *Fake) Set(now time.Time) {
+	f.mx.Lock()
+	if now.After(f.now) {
+		f.now = now
+	}
+
+	var due []*fakeWaiter
+	var fired []time.Time
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+		due = append(due, w)
+		fired = append(fired, w.at)
+		if w.period > 0 {
+			// like time.Ticker, the ticks are dropped for the slow receivers
+			for !w.at.After(f.now) {
+				w.at = w.at.Add(w.period)
+			}
+			pending = append(pending, w)
+		}
+	}
+	f.waiters = pending
+	f.mx.Unlock()
+
+	order := make([]int, len(due))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return fired[order[i]].Before(fired[order[j]]) })
+	for _, i := range order {
+		due[i].fire(fired[i])
+	}
+}
+
+// Waiters returns the number of the active timers and tickers
+func (f *Fake) Waiters() int {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	return len(f.waiters)
+}
+
+// BlockUntil waits until there are at least n active timers and tickers,
+// i.e. until the code under test is waiting for the clock to be advanced
+func (f *Fake) BlockUntil(ctx context.Context, n int) error {
+	for {
+		f.mx.Lock()
+		count, changed := len(f.waiters), f.changed
+		f.mx.Unlock()
+
+		if count >= n {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (f *Fake) start(w *fakeWaiter, d time.Duration) {
+	f.mx.Lock()
+	w.at = f.now.Add(d)
+	active := f.remove(w)
+	f.waiters = append(f.waiters, w)
+	if !active {
+		close(f.changed)
+		f.changed = make(chan struct{})
+	}
+	f.mx.Unlock()
+
+	if d <= 0 {
+		f.Set(f.Now())
+	}
+}
+
+// remove removes the waiter and returns whether it was active, the clock lock must be held
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *fakeWaiter) fire(now time.Time) {
+	if w.f != nil {
+		go w.f()
+		return
+	}
+	select {
+	case w.c <- now:
+	default:
+	}
+}
+
+// C implements Timer and Ticker
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// Stop implements Timer and Ticker
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mx.Lock()
+	defer w.clock.mx.Unlock()
+
+	return w.clock.remove(w)
+}
+
+// Reset implements Timer and Ticker
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mx.Lock()
+	active := w.clock.remove(w)
+	if w.period > 0 {
+		w.period = d
+	}
+	w.clock.mx.Unlock()
+
+	w.clock.start(w, d)
+	return active
+}
+
+type fakeTicker struct{ *fakeWaiter }
+
+// Stop implements Ticker
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+// Reset implements Ticker
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.fakeWaiter.Reset(d)
+}
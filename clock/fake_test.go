@@ -0,0 +1,97 @@
+package clock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/zero-sdk/clock"
+)
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("timer", func(t *testing.T) {
+		t.Parallel()
+
+		c := clock.NewFake(start)
+		timer := c.NewTimer(time.Minute)
+		assert.Equal(t, 1, c.Waiters())
+
+		c.Advance(time.Second * 59)
+		assert.Empty(t, timer.C())
+
+		c.Advance(time.Second)
+		assert.Equal(t, start.Add(time.Minute), <-timer.C())
+		assert.Zero(t, c.Waiters())
+		assert.False(t, timer.Stop(), "timer already fired")
+
+		assert.False(t, timer.Reset(time.Second))
+		assert.True(t, timer.Stop())
+		c.Advance(time.Hour)
+		assert.Empty(t, timer.C())
+	})
+
+	t.Run("ticker", func(t *testing.T) {
+		t.Parallel()
+
+		c := clock.NewFake(start)
+		ticker := c.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		c.Advance(time.Second)
+		assert.Equal(t, start.Add(time.Second), <-ticker.C())
+
+		c.Advance(time.Second * 10)
+		assert.Len(t, ticker.C(), 1, "slow receiver drops ticks")
+		<-ticker.C()
+
+		ticker.Reset(time.Minute)
+		c.Advance(time.Second * 59)
+		assert.Empty(t, ticker.C())
+		c.Advance(time.Second)
+		assert.Len(t, ticker.C(), 1)
+	})
+
+	t.Run("after func", func(t *testing.T) {
+		t.Parallel()
+
+		c := clock.NewFake(start)
+		called := make(chan struct{})
+		c.AfterFunc(time.Minute, func() { close(called) })
+		c.Advance(time.Minute)
+		<-called
+	})
+
+	t.Run("block until", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c := clock.NewFake(start)
+		done := make(chan time.Time)
+		go func() { done <- <-c.After(time.Hour) }()
+
+		require.NoError(t, c.BlockUntil(ctx, 1))
+		c.Advance(time.Hour)
+		assert.Equal(t, start.Add(time.Hour), <-done)
+	})
+
+	t.Run("with timeout", func(t *testing.T) {
+		t.Parallel()
+
+		c := clock.NewFake(start)
+		ctx, cancel := clock.WithTimeout(context.Background(), c, time.Minute)
+		defer cancel()
+
+		c.Advance(time.Minute)
+		<-ctx.Done()
+		assert.ErrorIs(t, context.Cause(ctx), context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,104 @@
+package zerosdk_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/clock"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func TestFakeClock(t *testing.T) {
+	t.Parallel()
+
+	t.Run("token expiry", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := testContext(t)
+		clk := clock.NewFake(time.Now())
+		srv := zerotest.NewServer(t, zerotest.WithClock(clk), zerotest.WithTokenTTL(time.Hour))
+
+		api := newTestAPI(t, srv)
+
+		_, err := api.GetClusterBootstrapConfig(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, srv.RequestCount("ExchangeClusterIdentityToken"))
+		assert.Equal(t, clk.Now().Add(time.Hour), api.Status().TokenExpires)
+
+		clk.Advance(time.Minute * 50)
+		_, err = api.GetClusterBootstrapConfig(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, srv.RequestCount("ExchangeClusterIdentityToken"), "token is still valid")
+
+		clk.Advance(time.Minute * 6)
+		_, err = api.GetClusterBootstrapConfig(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, srv.RequestCount("ExchangeClusterIdentityToken"), "token is about to expire")
+	})
+
+	t.Run("signed URL expiry", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := testContext(t)
+		clk := clock.NewFake(time.Now())
+		srv := zerotest.NewServer(t, zerotest.WithClock(clk), zerotest.WithDownloadURLTTL(time.Hour))
+		srv.SetBundle("config", []byte("bundle-data"))
+
+		api := newTestAPI(t, srv, zerosdk.WithDownloadURLCacheTTL(time.Minute*15))
+
+		download := func() {
+			t.Helper()
+			_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+			require.NoError(t, err)
+		}
+
+		download()
+		clk.Advance(time.Minute * 40)
+		download()
+		assert.Equal(t, 1, srv.RequestCount("DownloadClusterResourceBundle"), "download URL should be cached")
+
+		clk.Advance(time.Minute * 10)
+		download()
+		assert.Equal(t, 2, srv.RequestCount("DownloadClusterResourceBundle"), "download URL is about to expire")
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := testContext(t)
+		clk := clock.NewFake(time.Now())
+		srv := zerotest.NewServer(t, zerotest.WithClock(clk))
+
+		api := newTestAPI(t, srv)
+
+		connectCtx, cancel := context.WithCancel(ctx)
+		t.Cleanup(cancel)
+		go func() { _ = api.Connect(connectCtx) }()
+
+		// the first connection attempt waits for the initial tick
+		require.NoError(t, clk.BlockUntil(ctx, 1))
+		clk.Advance(time.Millisecond)
+		require.NoError(t, srv.WaitForStreams(ctx, 1))
+
+		srv.DropStreams()
+		require.Eventually(t, func() bool { return api.Status().LastError != nil },
+			time.Second*5, time.Millisecond)
+		assert.Zero(t, srv.StreamCount(), "reconnect should wait for the backoff")
+
+		// the backoff is randomized, and is reset asynchronously after the disconnect
+		require.Eventually(t, func() bool {
+			clk.Advance(time.Second)
+			return srv.StreamCount() == 1
+		}, time.Second*5, time.Millisecond*10)
+		require.Eventually(t, func() bool { return api.Status().Connected },
+			time.Second*5, time.Millisecond)
+		status := api.Status()
+		assert.True(t, status.LastDisconnected.Before(status.LastConnected), "reconnected on the fake clock")
+	})
+}
@@ -119,6 +119,9 @@ func (r *ReportClusterResourceBundleStatusResp) GetInternalServerError() (string
 }
 
 func (r *ReportClusterResourceBundleStatusResp) GetValue() *EmptyResponse {
+	if r.StatusCode() != http.StatusNoContent {
+		return nil
+	}
 	return &EmptyResponse{}
 }
 
@@ -55,7 +55,10 @@ type BundleStatusSuccess struct {
 type DownloadBundleResponse struct {
 	// CaptureMetadataHeaders bundle metadata that need be picked up by the client from the download URL
 	CaptureMetadataHeaders []string `json:"captureMetadataHeaders"`
-	ExpiresInSeconds       string   `json:"expiresInSeconds"`
+
+	// Checksum digest of the uncompressed bundle content, in the algorithm:hex form, i.e. sha256:<hex>
+	Checksum         *string `json:"checksum,omitempty"`
+	ExpiresInSeconds string  `json:"expiresInSeconds"`
 
 	// Url download URL
 	Url string `json:"url"`
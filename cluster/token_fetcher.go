@@ -7,17 +7,23 @@ import (
 	"time"
 
 	"github.com/pomerium/zero-sdk/apierror"
+	"github.com/pomerium/zero-sdk/clock"
 	"github.com/pomerium/zero-sdk/token"
 )
 
 func NewTokenFetcher(endpoint string, opts ...ClientOption) (token.Fetcher, error) {
+	return NewTokenFetcherWithClock(endpoint, clock.Real(), opts...)
+}
+
+// NewTokenFetcherWithClock creates the token fetcher, that computes the token expiration with the given clock
+func NewTokenFetcherWithClock(endpoint string, clk clock.Clock, opts ...ClientOption) (token.Fetcher, error) {
 	client, err := NewClientWithResponses(endpoint, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating client: %w", err)
 	}
 
 	return func(ctx context.Context, refreshToken string) (*token.Token, error) {
-		now := time.Now()
+		now := clk.Now()
 
 		resp, err := apierror.CheckResponse[ExchangeTokenResponse](client.ExchangeClusterIdentityTokenWithResponse(ctx, ExchangeTokenRequest{
 			RefreshToken: refreshToken,
@@ -4,13 +4,26 @@ import (
 	"net/url"
 	"sync"
 	"time"
+
+	"github.com/pomerium/zero-sdk/clock"
 )
 
 type URLCache struct {
+	clock clock.Clock
 	mx    sync.RWMutex
 	cache map[string]DownloadCacheEntry
 }
 
+// URLCacheOption configures the URLCache
+type URLCacheOption func(*URLCache)
+
+// WithURLCacheClock sets the clock the URL expiration is checked against
+func WithURLCacheClock(c clock.Clock) URLCacheOption {
+	return func(cache *URLCache) {
+		cache.clock = c
+	}
+}
+
 type DownloadCacheEntry struct {
 	// URL is the URL to download the bundle from.
 	URL url.URL
@@ -18,12 +31,19 @@ type DownloadCacheEntry struct {
 	ExpiresAt time.Time
 	// CaptureHeaders is a list of headers to capture from the response.
 	CaptureHeaders []string
+	// Checksum is the digest of the bundle content in the algorithm:hex form, empty if unknown.
+	Checksum string
 }
 
-func NewURLCache() *URLCache {
-	return &URLCache{
+func NewURLCache(opts ...URLCacheOption) *URLCache {
+	c := &URLCache{
+		clock: clock.Real(),
 		cache: make(map[string]DownloadCacheEntry),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *URLCache) Get(key string, minTTL time.Duration) (*DownloadCacheEntry, bool) {
@@ -35,7 +55,7 @@ func (c *URLCache) Get(key string, minTTL time.Duration) (*DownloadCacheEntry, b
 		return nil, false
 	}
 
-	if time.Until(entry.ExpiresAt) < minTTL {
+	if c.clock.Until(entry.ExpiresAt) < minTTL {
 		return nil, false
 	}
 
@@ -48,3 +68,23 @@ func (c *URLCache) Set(key string, entry DownloadCacheEntry) {
 
 	c.cache[key] = entry
 }
+
+// Delete removes the entry, i.e. once the URL was rejected by the storage
+func (c *URLCache) Delete(key string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	delete(c.cache, key)
+}
+
+// Entries returns a copy of all cache entries, including the expired ones
+func (c *URLCache) Entries() map[string]DownloadCacheEntry {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	entries := make(map[string]DownloadCacheEntry, len(c.cache))
+	for k, v := range c.cache {
+		entries[k] = v
+	}
+	return entries
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	connect_mux "github.com/pomerium/zero-sdk/connect-mux"
+)
+
+const redacted = "REDACTED"
+
+func (c *cli) token(ctx context.Context, api *zerosdk.API, args []string) error {
+	fs := newFlagSet("token", c.stderr)
+	showBearer := fs.Bool("show-token", false, "print the bearer token too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	token, err := api.GetToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := struct {
+		Expires   time.Time      `json:"expires"`
+		ExpiresIn string         `json:"expiresIn"`
+		Claims    map[string]any `json:"claims,omitempty"`
+		Bearer    string         `json:"bearer,omitempty"`
+	}{
+		Expires:   token.Expires,
+		ExpiresIn: time.Until(token.Expires).Round(time.Second).String(),
+		Claims:    jwtClaims(token.Bearer),
+	}
+	if *showBearer {
+		out.Bearer = token.Bearer
+	}
+	return c.printJSON(out)
+}
+
+// jwtClaims decodes the claims of the JWT without verifying it, nil if the token is not a JWT
+func jwtClaims(token string) map[string]any {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+func (c *cli) bootstrap(ctx context.Context, api *zerosdk.API, args []string) error {
+	fs := newFlagSet("bootstrap", c.stderr)
+	reveal := fs.Bool("reveal", false, "print the secrets as is")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := api.GetClusterBootstrapConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if *reveal {
+		return c.printJSON(cfg)
+	}
+
+	// round trip through JSON, so that any new fields are redacted too
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+	return c.printJSON(redact(out))
+}
+
+// redact replaces the strings with a placeholder, except for the URL scheme and host
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = redact(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = redact(e)
+		}
+		return v
+	case string:
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return redacted
+		}
+		return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + redacted}).String()
+	default:
+		return v
+	}
+}
+
+func (c *cli) bundles(ctx context.Context, api *zerosdk.API, args []string) error {
+	commands := map[string]func(context.Context, *zerosdk.API, []string) error{
+		"list":     c.bundlesList,
+		"download": c.bundlesDownload,
+		"report":   c.bundlesReport,
+	}
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return errUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "unknown bundles command: %s\n\n%s", args[0], usage)
+		return errUsage
+	}
+	return cmd(ctx, api, args[1:])
+}
+
+func (c *cli) bundlesList(ctx context.Context, api *zerosdk.API, args []string) error {
+	fs := newFlagSet("bundles list", c.stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	resp, err := api.GetClusterResourceBundles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range resp.Bundles {
+		fmt.Fprintln(c.stdout, b.Id)
+	}
+	return nil
+}
+
+func (c *cli) bundlesDownload(ctx context.Context, api *zerosdk.API, args []string) error {
+	fs := newFlagSet("bundles download", c.stderr)
+	output := fs.String("o", "-", "output `file`, - for stdout")
+	etag := fs.String("etag", "", "only download if the bundle ETag does not match")
+	lastModified := fs.String("last-modified", "", "only download if the bundle was modified since the HTTP `date`")
+	id, err := bundleID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var current *zerosdk.DownloadConditional
+	if *etag != "" || *lastModified != "" {
+		current = &zerosdk.DownloadConditional{ETag: *etag, LastModified: *lastModified}
+	}
+
+	var res *zerosdk.DownloadResult
+	if *output == "-" {
+		res, err = api.DownloadClusterResourceBundle(ctx, c.stdout, id, current)
+	} else {
+		res, err = api.DownloadClusterResourceBundleToFile(ctx, *output, id, current)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the body may be written to stdout, so the result goes to stderr
+	out := map[string]any{"notModified": res.NotModified}
+	if !res.NotModified {
+		out["digest"] = res.Digest
+		out["size"] = res.Size
+		out["compressedSize"] = res.CompressedSize
+	}
+	if res.ContentEncoding != "" {
+		out["contentEncoding"] = res.ContentEncoding
+	}
+	if res.DownloadConditional != nil {
+		out["etag"] = res.ETag
+		out["lastModified"] = res.LastModified
+	}
+	if len(res.Metadata) > 0 {
+		out["metadata"] = res.Metadata
+	}
+	return writeJSON(c.stderr, out)
+}
+
+func (c *cli) bundlesReport(ctx context.Context, api *zerosdk.API, args []string) error {
+	fs := newFlagSet("bundles report", c.stderr)
+	success := fs.Bool("success", false, "report the bundle was applied")
+	failure := fs.Bool("failure", false, "report the bundle failed to apply")
+	source := fs.String("source", string(cluster_api.UnknownError), "failure `source`")
+	message := fs.String("message", "", "failure message")
+	metadata := make(metadataFlag)
+	fs.Var(metadata, "metadata", "success metadata `key=value`, may be repeated")
+	id, err := bundleID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *success == *failure:
+		fmt.Fprintln(c.stderr, "exactly one of -success and -failure is required")
+		return errUsage
+	case *success:
+		return api.ReportBundleAppliedSuccess(ctx, id, metadata)
+	default:
+		if *message == "" {
+			*message = "reported with zero command"
+		}
+		return api.ReportBundleAppliedFailure(ctx, id, cluster_api.BundleStatusFailureSource(*source), errors.New(*message))
+	}
+}
+
+// bundleID parses the flags and returns the single positional bundle ID
+func bundleID(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		fmt.Fprintf(fs.Output(), "%s: exactly one bundle ID is required\n", fs.Name())
+		return "", errUsage
+	}
+	return positional[0], nil
+}
+
+// metadataFlag collects the key=value pairs
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m metadataFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	m[k] = v
+	return nil
+}
+
+// watchEvent is the connect event printed by the watch command
+type watchEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	BundleID string    `json:"bundleId,omitempty"`
+}
+
+func (c *cli) watch(ctx context.Context, api *zerosdk.API, args []string) error {
+	fs := newFlagSet("watch", c.stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	go func() {
+		if err := api.Connect(ctx); err != nil {
+			cancel(err)
+		}
+	}()
+
+	emit := func(evt watchEvent) {
+		evt.Time = time.Now()
+		if err := writeJSON(c.stdout, evt); err != nil {
+			cancel(err)
+		}
+	}
+	err := api.Watch(ctx,
+		connect_mux.WithOnConnected(func(context.Context) { emit(watchEvent{Event: "connected"}) }),
+		connect_mux.WithOnDisconnected(func(context.Context) { emit(watchEvent{Event: "disconnected"}) }),
+		connect_mux.WithOnBundleUpdated(func(_ context.Context, id string) {
+			emit(watchEvent{Event: "bundle_updated", BundleID: id})
+		}),
+		connect_mux.WithOnBootstrapConfigUpdated(func(context.Context) {
+			emit(watchEvent{Event: "bootstrap_config_updated"})
+		}),
+	)
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
+	}
+	if errors.Is(err, context.Canceled) {
+		// interrupted
+		return nil
+	}
+	return err
+}
+
+func (c *cli) printJSON(v any) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeJSON writes the value as a single JSON line
+func writeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
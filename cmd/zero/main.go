@@ -0,0 +1,135 @@
+// Command zero operates a Pomerium Zero cluster identity,
+// i.e. to check what the cluster token can see without writing Go.
+//
+// The API is configured with the POMERIUM_ZERO_* environment variables and the optional config file,
+// see zerosdk.LoadConfig.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+)
+
+const usage = `Usage: zero [-config file] [-v] <command> [arguments]
+
+Commands:
+  token                                   exchange the API token and print its claims and expiry
+  bootstrap [-reveal]                     print the bootstrap config, secrets are redacted unless -reveal is set
+  bundles list                            list the resource bundles
+  bundles download <id> [-o file] [-etag etag] [-last-modified date]
+                                          download the bundle to the file or stdout
+  bundles report <id> -success|-failure [-source source] [-message message] [-metadata key=value]
+                                          report the bundle status
+  watch                                   stream the connect events as JSON lines
+
+The API is configured with the POMERIUM_ZERO_* environment variables and the config file.
+Only the warnings are logged to stderr, unless -v is set.
+`
+
+// errUsage is returned for the invalid command line, the usage is printed then
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "zero: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// cli is the command invocation
+type cli struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// run runs the command line, opts are applied to the API after the loaded config
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, opts ...zerosdk.Option) error {
+	fs := newFlagSet("zero", stderr)
+	configFile := fs.String("config", os.Getenv(zerosdk.EnvConfigFile), "YAML or JSON config `file`")
+	verbose := fs.Bool("v", false, "log the debug messages")
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c := &cli{stdout: stdout, stderr: stderr}
+	commands := map[string]func(context.Context, *zerosdk.API, []string) error{
+		"token":     c.token,
+		"bootstrap": c.bootstrap,
+		"bundles":   c.bundles,
+		"watch":     c.watch,
+	}
+
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command: %s\n\n", args[0])
+		fs.Usage()
+		return errUsage
+	}
+
+	loaded, err := zerosdk.LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	// the download result is written to stderr, so the SDK only logs what needs attention by default
+	level := zerolog.WarnLevel
+	if *verbose {
+		level = zerolog.DebugLevel
+	}
+	logger := zerolog.New(stderr).Level(level).With().Timestamp().Logger()
+
+	opts = append(append([]zerosdk.Option{zerosdk.WithLogger(&logger)}, loaded...), opts...)
+	api, err := zerosdk.NewAPI(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer api.Close()
+
+	return cmd(ctx, api, args[1:])
+}
+
+// newFlagSet creates the flag set, that reports the errors to the caller
+func newFlagSet(name string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	return fs
+}
+
+// parseInterspersed parses the flags that may follow the positional arguments, and returns the positional ones
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
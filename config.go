@@ -1,9 +1,23 @@
 package zerosdk
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pomerium/zero-sdk/clock"
+	connect_api "github.com/pomerium/zero-sdk/connect"
 )
 
 type Option func(*config)
@@ -14,6 +28,24 @@ type config struct {
 	apiToken            string
 	httpClient          *http.Client
 	downloadURLCacheTTL time.Duration
+	retryPolicy         RetryPolicy
+	tracerProvider      trace.TracerProvider
+	propagator          propagation.TextMapPropagator
+	meterProvider       metric.MeterProvider
+	tlsConfig           *tls.Config
+	proxy               func(*http.Request) (*url.URL, error)
+	logger              zerolog.Logger
+	clock               clock.Clock
+
+	bootstrapConfigCachePath string
+	bootstrapConfigCacheKey  []byte
+
+	// metricAttributes are recorded with all the metrics, i.e. the Manager cluster key
+	metricAttributes []attribute.KeyValue
+
+	// shared is the HTTP client and connect API connection pool shared by the Manager clusters,
+	// it is reset by the options that change the transport
+	shared *sharedTransport
 }
 
 // WithClusterAPIEndpoint sets the cluster API endpoint
@@ -41,6 +73,7 @@ func WithAPIToken(token string) Option {
 func WithHTTPClient(client *http.Client) Option {
 	return func(cfg *config) {
 		cfg.httpClient = client
+		cfg.shared = nil
 	}
 }
 
@@ -51,11 +84,126 @@ func WithDownloadURLCacheTTL(ttl time.Duration) Option {
 	}
 }
 
+// WithRetryPolicy sets the retry policy of the cluster API calls, that by default are not retried.
+// The policy may be overridden for individual calls with ContextWithRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(cfg *config) {
+		cfg.retryPolicy = policy
+	}
+}
+
+// WithTracerProvider sets the tracer provider used to trace the cluster API operations,
+// bundle downloads, token exchange and the received connect messages.
+// By default, the global tracer provider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cfg *config) {
+		cfg.tracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator used to propagate the trace context
+// on the outgoing cluster API and connect API requests.
+// By default, the global propagator is used.
+// If it is set for a Manager cluster, that cluster uses its own connect API connection.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(cfg *config) {
+		cfg.propagator = propagator
+		if cfg.shared != nil {
+			// the shared connect API connection propagates with the Manager propagator
+			cfg.shared = &sharedTransport{httpClient: cfg.shared.httpClient}
+		}
+	}
+}
+
+// WithMeterProvider sets the meter provider used to record the metrics of the cluster API requests,
+// token refreshes, bundle downloads, connect stream and received messages.
+// By default, the global meter provider is used.
+// To expose the metrics to Prometheus, use a provider with the OpenTelemetry Prometheus exporter.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(cfg *config) {
+		cfg.meterProvider = mp
+	}
+}
+
+// WithTLSConfig sets the TLS config used to connect to the cluster API, the bundle storage and the connect API,
+// i.e. to trust a private CA bundle or present a client certificate.
+// It requires the HTTP client transport to be either nil or *http.Transport.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(cfg *config) {
+		cfg.tlsConfig = tlsConfig
+		cfg.shared = nil
+	}
+}
+
+// WithProxy sets the function that selects the HTTP proxy for the cluster API, the bundle storage
+// and the connect API requests; the connect API connections are tunneled with HTTP CONNECT.
+// Use http.ProxyFromEnvironment to honour HTTPS_PROXY and NO_PROXY environment variables,
+// that is also what the default HTTP client and the connect API do if the proxy is not set.
+// It requires the HTTP client transport to be either nil or *http.Transport.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(cfg *config) {
+		cfg.proxy = proxy
+		cfg.shared = nil
+	}
+}
+
+// WithLogger sets the logger used by the API, the connect stream and the bundle downloads.
+// By default, the global zerolog logger is used; nil disables logging.
+func WithLogger(logger *zerolog.Logger) Option {
+	return func(cfg *config) {
+		if logger == nil {
+			cfg.logger = zerolog.Nop()
+			return
+		}
+		cfg.logger = *logger
+	}
+}
+
+// WithClock sets the clock used for the token and download URL expiration, the retry and reconnect backoff,
+// and the timestamps reported by the API, so that the tests may control the time. By default, the real clock is used.
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// WithBootstrapConfigCache enables persisting the last successfully fetched bootstrap config to the given file,
+// so that it may be served by GetClusterBootstrapConfigWithFallback when the cluster API is unreachable.
+// The file is encrypted with a key derived from the given key material, or from the API token if key is nil.
+func WithBootstrapConfigCache(path string, key []byte) Option {
+	return func(cfg *config) {
+		cfg.bootstrapConfigCachePath = path
+		cfg.bootstrapConfigCacheKey = key
+	}
+}
+
 func newConfig(opts ...Option) (*config, error) {
+	cfg := newDefaultConfig(opts...)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.shared != nil {
+		cfg.httpClient = cfg.shared.httpClient
+		return cfg, nil
+	}
+	if err := cfg.applyTransportOptions(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// newDefaultConfig applies the options over the defaults, without validating them
+func newDefaultConfig(opts ...Option) *config {
 	cfg := new(config)
 	for _, opt := range []Option{
 		WithHTTPClient(http.DefaultClient),
 		WithDownloadURLCacheTTL(15 * time.Minute),
+		WithRetryPolicy(NoRetry),
+		WithTracerProvider(otel.GetTracerProvider()),
+		WithPropagator(otel.GetTextMapPropagator()),
+		WithMeterProvider(otel.GetMeterProvider()),
+		WithLogger(&log.Logger),
+		WithClock(clock.Real()),
 	} {
 		opt(cfg)
 	}
@@ -63,24 +211,88 @@ func newConfig(opts ...Option) (*config, error) {
 	for _, opt := range opts {
 		opt(cfg)
 	}
-	if err := cfg.validate(); err != nil {
-		return nil, err
+	return cfg
+}
+
+// applyTransportOptions sets the TLS config and proxy on a copy of the HTTP client transport
+func (c *config) applyTransportOptions() error {
+	if c.tlsConfig == nil && c.proxy == nil {
+		return nil
 	}
-	return cfg, nil
+
+	var transport *http.Transport
+	switch t := c.httpClient.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return fmt.Errorf("TLS config and proxy options require *http.Transport, got %T", t)
+	}
+
+	if c.tlsConfig != nil {
+		transport.TLSClientConfig = c.tlsConfig.Clone()
+	}
+	if c.proxy != nil {
+		transport.Proxy = c.proxy
+	}
+
+	client := *c.httpClient
+	client.Transport = transport
+	c.httpClient = &client
+	return nil
 }
 
+// validate reports all the invalid options at once
 func (c *config) validate() error {
+	var errs *multierror.Error
 	if c.clusterAPIEndpoint == "" {
-		return fmt.Errorf("cluster API endpoint is required")
+		errs = multierror.Append(errs, fmt.Errorf("cluster API endpoint is required"))
+	} else if err := validateEndpoint(c.clusterAPIEndpoint); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("cluster API endpoint: %w", err))
 	}
 	if c.connectAPIEndpoint == "" {
-		return fmt.Errorf("connect API endpoint is required")
+		errs = multierror.Append(errs, fmt.Errorf("connect API endpoint is required"))
+	} else if _, err := connect_api.NewConfig(c.connectAPIEndpoint); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("connect API endpoint: %w", err))
 	}
 	if c.apiToken == "" {
-		return fmt.Errorf("API token is required")
+		errs = multierror.Append(errs, fmt.Errorf("API token is required"))
 	}
 	if c.httpClient == nil {
-		return fmt.Errorf("HTTP client is required")
+		errs = multierror.Append(errs, fmt.Errorf("HTTP client is required"))
+	}
+	if c.downloadURLCacheTTL < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("download URL cache TTL must not be negative"))
+	}
+	if c.retryPolicy.MaxAttempts < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("retry policy max attempts must not be negative"))
+	}
+	if c.tracerProvider == nil {
+		errs = multierror.Append(errs, fmt.Errorf("tracer provider is required"))
+	}
+	if c.propagator == nil {
+		errs = multierror.Append(errs, fmt.Errorf("propagator is required"))
+	}
+	if c.clock == nil {
+		errs = multierror.Append(errs, fmt.Errorf("clock is required"))
+	}
+	if c.meterProvider == nil {
+		errs = multierror.Append(errs, fmt.Errorf("meter provider is required"))
+	}
+	return errs.ErrorOrNil()
+}
+
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("host is required")
 	}
 	return nil
 }
@@ -1,6 +1,79 @@
 package mux
 
-import "context"
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pomerium/zero-sdk/clock"
+)
+
+type muxConfig struct {
+	tracerProvider   trace.TracerProvider
+	meterProvider    metric.MeterProvider
+	metricAttributes []attribute.KeyValue
+	logger           zerolog.Logger
+	clock            clock.Clock
+}
+
+// Option configures the Mux
+type Option func(*muxConfig)
+
+// WithTracerProvider sets the tracer provider used to trace received and dispatched messages
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cfg *muxConfig) {
+		cfg.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider sets the meter provider used to record the connect stream and received messages metrics
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(cfg *muxConfig) {
+		cfg.meterProvider = mp
+	}
+}
+
+// WithMetricAttributes sets the attributes recorded with the metrics, i.e. to tell apart the Muxes of several clusters
+func WithMetricAttributes(attrs ...attribute.KeyValue) Option {
+	return func(cfg *muxConfig) {
+		cfg.metricAttributes = attrs
+	}
+}
+
+// WithLogger sets the logger of the connect stream, by default nothing is logged
+func WithLogger(logger zerolog.Logger) Option {
+	return func(cfg *muxConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithClock sets the clock used for the reconnect backoff, the status timestamps and the fanout timeouts
+func WithClock(c clock.Clock) Option {
+	return func(cfg *muxConfig) {
+		cfg.clock = c
+	}
+}
+
+func newMuxConfig(opts ...Option) *muxConfig {
+	cfg := &muxConfig{}
+	for _, opt := range []Option{
+		WithTracerProvider(otel.GetTracerProvider()),
+		WithMeterProvider(otel.GetMeterProvider()),
+		WithLogger(zerolog.Nop()),
+		WithClock(clock.Real()),
+	} {
+		opt(cfg)
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
 
 type config struct {
 	onConnected              func(ctx context.Context)
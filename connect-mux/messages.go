@@ -4,17 +4,21 @@ import (
 	"context"
 	"fmt"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/pomerium/zero-sdk/apierror"
 	"github.com/pomerium/zero-sdk/connect"
 )
 
 // Watch watches for changes to the config until either context is cancelled,
-// or an error occurs while muxing
+// or an error occurs while muxing. If the Mux is not running, it waits until it is started.
+// Once the Mux is stopped, Watch returns fanout.ErrStopped, and once it is closed, ErrStopped.
 func (svc *Mux) Watch(ctx context.Context, opts ...WatchOption) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-svc.ready:
+	f, err := svc.running(ctx)
+	if err != nil {
+		return err
 	}
 
 	cfg := newConfig(opts...)
@@ -26,8 +30,24 @@ func (svc *Mux) Watch(ctx context.Context, opts ...WatchOption) error {
 		cfg.onDisconnected(ctx)
 	}
 
-	return svc.mux.Receive(ctx, func(ctx context.Context, msg message) error {
-		return dispatch(ctx, cfg, msg)
+	return f.Receive(ctx, func(ctx context.Context, msg message) error {
+		if msg.Message == nil {
+			return dispatch(ctx, cfg, msg)
+		}
+
+		ctx = trace.ContextWithSpanContext(ctx, msg.spanContext)
+		ctx, span := svc.tracer.Start(ctx, "connect.dispatch",
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes(attribute.String("zero.message.type", messageType(msg.Message))),
+		)
+		defer span.End()
+
+		err := dispatch(ctx, cfg, msg)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
 	})
 }
 
@@ -60,6 +80,20 @@ func dispatch(ctx context.Context, cfg *config, msg message) error {
 type message struct {
 	*stateChange
 	*connect.Message
+	// spanContext is the span of the message receive, the dispatch spans are its children
+	spanContext trace.SpanContext
+}
+
+// messageType returns a short name of the message type, suitable for telemetry
+func messageType(msg *connect.Message) string {
+	switch msg.Message.(type) {
+	case *connect.Message_ConfigUpdated:
+		return "config_updated"
+	case *connect.Message_BootstrapConfigUpdated:
+		return "bootstrap_config_updated"
+	default:
+		return "unknown"
+	}
 }
 
 type stateChange string
@@ -83,6 +117,8 @@ func (svc *Mux) publish(ctx context.Context, msg message) error {
 func (svc *Mux) onConnected(ctx context.Context) error {
 	s := connected
 	svc.connected.Store(true)
+	svc.metrics.recordConnect(ctx)
+	svc.status.update(func(s *Status) { s.LastConnected = svc.clock.Now() })
 	err := svc.publish(ctx, message{stateChange: &s})
 	if err != nil {
 		return fmt.Errorf("onConnected: %w", err)
@@ -93,6 +129,8 @@ func (svc *Mux) onConnected(ctx context.Context) error {
 func (svc *Mux) onDisconnected(ctx context.Context) error {
 	s := disconnected
 	svc.connected.Store(false)
+	svc.metrics.recordDisconnect(ctx)
+	svc.status.update(func(s *Status) { s.LastDisconnected = svc.clock.Now() })
 	err := svc.publish(ctx, message{stateChange: &s})
 	if err != nil {
 		return fmt.Errorf("onDisconnected: %w", err)
@@ -101,8 +139,20 @@ func (svc *Mux) onDisconnected(ctx context.Context) error {
 }
 
 func (svc *Mux) onMessage(ctx context.Context, msg *connect.Message) error {
-	err := svc.publish(ctx, message{Message: msg})
+	msgType := messageType(msg)
+	svc.metrics.recordMessage(ctx, msgType)
+	svc.status.update(func(s *Status) { s.LastMessage = svc.clock.Now() })
+
+	ctx, span := svc.tracer.Start(ctx, "connect.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("zero.message.type", msgType)),
+	)
+	defer span.End()
+
+	err := svc.publish(ctx, message{Message: msg, spanContext: span.SpanContext()})
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("onMessage: %w", err)
 	}
 	return nil
@@ -0,0 +1,112 @@
+package mux
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// metrics of the connect stream and the fanout of the received messages
+type metrics struct {
+	connects         metric.Int64Counter
+	disconnects      metric.Int64Counter
+	reconnectBackoff metric.Float64Histogram
+	messages         metric.Int64Counter
+	evictions        metric.Int64Counter
+
+	// attrs are recorded with every measurement, i.e. to tell the clusters apart
+	attrs attribute.Set
+	// registration of the gauges callback, that references the Mux
+	registration metric.Registration
+}
+
+// newMetrics creates the instruments with the meter of the given provider.
+// Failing that, the error is reported to the global OpenTelemetry error handler,
+// and the metrics are not recorded.
+func newMetrics(mp metric.MeterProvider, attrs []attribute.KeyValue, svc *Mux) *metrics {
+	m, err := createMetrics(mp.Meter(instrumentationName), attribute.NewSet(attrs...), svc)
+	if err != nil {
+		otel.Handle(err)
+		m, _ = createMetrics(noop.NewMeterProvider().Meter(instrumentationName), attribute.NewSet(attrs...), svc)
+	}
+	return m
+}
+
+func createMetrics(meter metric.Meter, attrs attribute.Set, svc *Mux) (*metrics, error) {
+	m := &metrics{attrs: attrs}
+
+	var errs *multierror.Error
+	var err error
+	m.connects, err = meter.Int64Counter("zero.connect.connects",
+		metric.WithDescription("Number of times the connect stream was established"))
+	errs = multierror.Append(errs, err)
+	m.disconnects, err = meter.Int64Counter("zero.connect.disconnects",
+		metric.WithDescription("Number of times the established connect stream was lost"))
+	errs = multierror.Append(errs, err)
+	m.reconnectBackoff, err = meter.Float64Histogram("zero.connect.reconnect.backoff",
+		metric.WithDescription("Interval before the next attempt to establish the connect stream"),
+		metric.WithUnit("s"))
+	errs = multierror.Append(errs, err)
+	m.messages, err = meter.Int64Counter("zero.connect.messages",
+		metric.WithDescription("Number of messages received from the connect stream, by type"))
+	errs = multierror.Append(errs, err)
+	m.evictions, err = meter.Int64Counter("zero.connect.subscriber.evictions",
+		metric.WithDescription("Number of watchers evicted as they could not keep up consuming messages"))
+	errs = multierror.Append(errs, err)
+
+	connected, err := meter.Int64ObservableGauge("zero.connect.connected",
+		metric.WithDescription("Whether the connect stream is currently established"))
+	errs = multierror.Append(errs, err)
+	subscribers, err := meter.Int64ObservableGauge("zero.connect.subscribers",
+		metric.WithDescription("Number of watchers currently subscribed to the received messages"))
+	errs = multierror.Append(errs, err)
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	// the callback is unregistered once the Mux is closed, so that it does not keep the Mux alive
+	m.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		var v int64
+		if svc.connected.Load() {
+			v = 1
+		}
+		o.ObserveInt64(connected, v, metric.WithAttributeSet(m.attrs))
+		o.ObserveInt64(subscribers, int64(svc.status.get().Subscribers), metric.WithAttributeSet(m.attrs))
+		return nil
+	}, connected, subscribers)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// unregister stops observing the gauges
+func (m *metrics) unregister() error {
+	return m.registration.Unregister()
+}
+
+func (m *metrics) recordConnect(ctx context.Context) {
+	m.connects.Add(ctx, 1, metric.WithAttributeSet(m.attrs))
+}
+
+func (m *metrics) recordDisconnect(ctx context.Context) {
+	m.disconnects.Add(ctx, 1, metric.WithAttributeSet(m.attrs))
+}
+
+func (m *metrics) recordEviction() {
+	m.evictions.Add(context.Background(), 1, metric.WithAttributeSet(m.attrs))
+}
+
+func (m *metrics) recordBackoff(ctx context.Context, next time.Duration) {
+	m.reconnectBackoff.Record(ctx, next.Seconds(), metric.WithAttributeSet(m.attrs))
+}
+
+func (m *metrics) recordMessage(ctx context.Context, msgType string) {
+	m.messages.Add(ctx, 1, metric.WithAttributeSet(m.attrs),
+		metric.WithAttributes(attribute.String("zero.message.type", msgType)))
+}
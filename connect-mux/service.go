@@ -3,46 +3,86 @@ package mux
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/hashicorp/go-multierror"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/pomerium/zero-sdk/apierror"
+	"github.com/pomerium/zero-sdk/clock"
 	"github.com/pomerium/zero-sdk/connect"
 	"github.com/pomerium/zero-sdk/fanout"
 )
 
-// Start starts the updates service, listening for updates from the cloud
-// until the context is canceled
-func New(client connect.ConnectClient) *Mux {
+const instrumentationName = "github.com/pomerium/zero-sdk/connect-mux"
+
+var (
+	// ErrStopped is returned by Run once the Mux was stopped with Stop,
+	// and by Run and Watch once the Mux is closed
+	ErrStopped = errors.New("mux is stopped")
+	// ErrRunning is returned by Run if the Mux is already running
+	ErrRunning = errors.New("mux is already running")
+)
+
+// New creates the updates service, that listens for updates from the cloud once it is run
+func New(client connect.ConnectClient, opts ...Option) *Mux {
+	cfg := newMuxConfig(opts...)
 	svc := &Mux{
 		client: client,
+		tracer: cfg.tracerProvider.Tracer(instrumentationName),
+		logger: cfg.logger,
+		clock:  cfg.clock,
 		ready:  make(chan struct{}),
 	}
+	svc.metrics = newMetrics(cfg.meterProvider, cfg.metricAttributes, svc)
 	return svc
 }
 
 type Mux struct {
-	client connect.ConnectClient
-	mux    *fanout.FanOut[message]
-
+	client  connect.ConnectClient
+	tracer  trace.Tracer
+	metrics *metrics
+	logger  zerolog.Logger
+	clock   clock.Clock
+
+	mx sync.Mutex
+	// mux is the fanout of the current run, nil if the Mux is not running
+	mux *fanout.FanOut[message]
+	// ready is closed once the Mux is running, and replaced when it stops
 	ready chan struct{}
+	// stop cancels the current run, and done is closed once it has returned
+	stop context.CancelCauseFunc
+	done chan struct{}
+	// closed is set once the Mux is closed, and may not be run anymore
+	closed bool
 
 	connected atomic.Bool
+	status    status
 }
 
+// Run listens for updates from the cloud and dispatches them to the watchers,
+// until either the context is canceled, Stop is called or a terminal error occurs.
+// Once Run returns, the watchers are stopped, and the Mux may be run again.
 func (svc *Mux) Run(ctx context.Context, opts ...fanout.Option) error {
 	ctx, cancel := context.WithCancelCause(ctx)
 	defer func() { cancel(ctx.Err()) }()
 
-	svc.mux = fanout.Start[message](ctx, opts...)
-	close(svc.ready)
+	if err := svc.start(ctx, cancel, opts...); err != nil {
+		return err
+	}
+	defer svc.finish()
 
 	err := svc.run(ctx)
+	if cause := context.Cause(ctx); cause != nil {
+		// the run was stopped, so the errors tearing down the stream are irrelevant
+		return cause
+	}
 	if err != nil {
 		cancel(err)
 		return err
@@ -50,28 +90,127 @@ func (svc *Mux) Run(ctx context.Context, opts ...fanout.Option) error {
 	return nil
 }
 
+// Stop stops the running Mux and waits until Run returns
+func (svc *Mux) Stop() {
+	svc.mx.Lock()
+	stop, done := svc.stop, svc.done
+	svc.mx.Unlock()
+
+	if stop == nil {
+		return
+	}
+	stop(ErrStopped)
+	<-done
+}
+
+// Close stops the Mux, and unregisters its metrics callbacks.
+// The Mux may not be run once it is closed.
+func (svc *Mux) Close() error {
+	svc.mx.Lock()
+	if svc.closed {
+		svc.mx.Unlock()
+		return nil
+	}
+	svc.closed = true
+	if svc.mux == nil {
+		// wake up the watchers waiting for the Mux to run
+		close(svc.ready)
+	}
+	svc.mx.Unlock()
+
+	svc.Stop()
+	return svc.metrics.unregister()
+}
+
+func (svc *Mux) start(ctx context.Context, cancel context.CancelCauseFunc, opts ...fanout.Option) error {
+	svc.mx.Lock()
+	defer svc.mx.Unlock()
+
+	if svc.closed {
+		return ErrStopped
+	}
+	if svc.stop != nil {
+		return ErrRunning
+	}
+
+	svc.mux = fanout.Start[message](ctx, append(svc.fanoutOptions(), opts...)...)
+	svc.stop = cancel
+	svc.done = make(chan struct{})
+	close(svc.ready)
+	return nil
+}
+
+func (svc *Mux) finish() {
+	svc.mx.Lock()
+	defer svc.mx.Unlock()
+
+	svc.connected.Store(false)
+	svc.mux = nil
+	svc.stop = nil
+	close(svc.done)
+	if !svc.closed {
+		svc.ready = make(chan struct{})
+	}
+}
+
+// running waits until the Mux is running, and returns the fanout of the current run
+func (svc *Mux) running(ctx context.Context) (*fanout.FanOut[message], error) {
+	for {
+		svc.mx.Lock()
+		f, ready, closed := svc.mux, svc.ready, svc.closed
+		svc.mx.Unlock()
+
+		if closed {
+			return nil, ErrStopped
+		}
+		if f != nil {
+			return f, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ready:
+		}
+	}
+}
+
 func (svc *Mux) run(ctx context.Context) error {
 	bo := backoff.NewExponentialBackOff()
 	bo.MaxElapsedTime = 0
+	bo.Clock = svc.clock
+	bo.Reset()
 
-	ticker := time.NewTicker(time.Microsecond)
+	ticker := svc.clock.NewTicker(time.Microsecond)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ticker.C:
+		case <-ticker.C():
 		}
 
 		err := svc.subscribeAndDispatch(ctx, bo.Reset)
-		if err != nil {
-			ticker.Reset(bo.NextBackOff())
+		if err != nil && ctx.Err() == nil {
+			svc.status.update(func(s *Status) {
+				s.LastError = err
+				s.LastErrorTime = svc.clock.Now()
+			})
 		}
-
 		if apierror.IsTerminalError(err) {
+			svc.logger.Error().Err(err).Msg("connect stream stopped")
 			return err
 		}
+
+		if err != nil {
+			next := bo.NextBackOff()
+			if ctx.Err() == nil {
+				svc.logger.Warn().Err(err).Dur("next", next).Msg("connect stream disconnected, will reconnect")
+			}
+			svc.metrics.recordBackoff(ctx, next)
+			ticker.Reset(next)
+		}
 	}
 }
 
@@ -92,13 +231,13 @@ func (svc *Mux) subscribeAndDispatch(ctx context.Context, onConnected func()) (e
 		err = multierror.Append(err, svc.onDisconnected(ctx)).ErrorOrNil()
 	}()
 
-	log.Ctx(ctx).Info().Msg("subscribed to connect service")
+	svc.logger.Info().Msg("subscribed to connect service")
 	for {
 		msg, err := stream.Recv()
-		log.Ctx(ctx).Info().Interface("msg", msg).Err(err).Msg("receive")
 		if err != nil {
 			return fmt.Errorf("receive: %w", err)
 		}
+		svc.logger.Debug().Str("message_type", messageType(msg)).Msg("received message")
 		err = svc.onMessage(ctx, msg)
 		if err != nil {
 			return err
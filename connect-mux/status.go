@@ -0,0 +1,72 @@
+package mux
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pomerium/zero-sdk/fanout"
+)
+
+// Status is the snapshot of the Mux state
+type Status struct {
+	// Running is true while the Mux is running
+	Running bool
+	// Connected is true while the connect stream is established
+	Connected bool
+	// LastConnected is the time the connect stream was last established
+	LastConnected time.Time
+	// LastDisconnected is the time the established connect stream was last lost
+	LastDisconnected time.Time
+	// LastMessage is the time the last message was received from the connect stream
+	LastMessage time.Time
+	// LastError is the last error of the connect stream, nil if there was none
+	LastError error
+	// LastErrorTime is the time the last error occurred
+	LastErrorTime time.Time
+	// Subscribers is the number of watchers subscribed to the received messages
+	Subscribers int
+}
+
+// status tracks the Mux state, apart from the connected flag that is read on the hot path
+type status struct {
+	mx sync.Mutex
+	Status
+}
+
+func (s *status) update(fn func(*Status)) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	fn(&s.Status)
+}
+
+func (s *status) get() Status {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.Status
+}
+
+// Status returns the snapshot of the Mux state
+func (svc *Mux) Status() Status {
+	st := svc.status.get()
+	st.Connected = svc.connected.Load()
+
+	svc.mx.Lock()
+	st.Running = svc.mux != nil
+	svc.mx.Unlock()
+
+	return st
+}
+
+// fanoutOptions returns the fanout options that track the subscribers
+func (svc *Mux) fanoutOptions() []fanout.Option {
+	return []fanout.Option{
+		fanout.WithLogger(svc.logger),
+		fanout.WithClock(svc.clock),
+		fanout.WithOnSubscriberCount(func(n int) {
+			svc.status.update(func(s *Status) { s.Subscribers = n })
+		}),
+		fanout.WithOnSubscriberEvicted(svc.metrics.recordEviction),
+	}
+}
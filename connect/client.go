@@ -19,46 +19,71 @@ type client struct {
 	minTokenTTL   time.Duration
 }
 
+// Client is the connect client that owns the underlying gRPC connection
+type Client interface {
+	ConnectClient
+	// Close closes the gRPC connection, any active streams are terminated
+	Close() error
+}
+
+type closableClient struct {
+	ConnectClient
+	conn *grpc.ClientConn
+}
+
+// Close implements Client
+func (c *closableClient) Close() error {
+	return c.conn.Close()
+}
+
 // TokenProviderFn is a function that returns a token that is expected to be valid for at least minTTL
 type TokenProviderFn func(ctx context.Context, minTTL time.Duration) (string, error)
 
+// NewAuthorizedConnectClient creates a new connect client, that authorizes requests with the token from the provider.
+// The client should be closed when no longer used.
 func NewAuthorizedConnectClient(
 	ctx context.Context,
 	endpoint string,
 	tokenProvider TokenProviderFn,
-) (ConnectClient, error) {
-	cfg, err := NewConfig(endpoint)
+	opts ...Option,
+) (Client, error) {
+	cfg, err := NewConfig(endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcConn, err := dial(ctx, cfg, grpc.WithPerRPCCredentials(newClient(cfg, tokenProvider)))
 	if err != nil {
 		return nil, err
 	}
 
-	cc := &client{
+	return &closableClient{
+		ConnectClient: NewConnectClient(grpcConn),
+		conn:          grpcConn,
+	}, nil
+}
+
+func newClient(cfg *Config, tokenProvider TokenProviderFn) *client {
+	return &client{
 		tokenProvider: tokenProvider,
 		config:        cfg,
 		// streaming connection would reset based on token duration,
 		// so we need it be close to max duration 1hr
 		minTokenTTL: time.Minute * 55,
 	}
-
-	grpcConn, err := cc.getGRPCConn(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	return NewConnectClient(grpcConn), nil
 }
 
-func (c *client) getGRPCConn(ctx context.Context) (*grpc.ClientConn, error) {
-	conn, err := grpc.DialContext(ctx,
-		c.config.GetConnectionURI(),
-		append(c.config.GetDialOptions(),
-			grpc.WithPerRPCCredentials(c),
-			grpc.WithConnectParams(grpc.ConnectParams{
-				Backoff: grpc_backoff.DefaultConfig,
-				// the MinConnectTimeout is confusing and is actually the max timeout as per grpc implementation
-				MinConnectTimeout: c.config.GetDialTimeout(),
-			}),
-		)...)
+func dial(ctx context.Context, cfg *Config, extra ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts := append([]grpc.DialOption{
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: grpc_backoff.DefaultConfig,
+			// the MinConnectTimeout is confusing and is actually the max timeout as per grpc implementation
+			MinConnectTimeout: cfg.GetDialTimeout(),
+		}),
+	}, cfg.GetDialOptions()...)
+	opts = append(opts, extra...)
+
+	conn, err := grpc.DialContext(ctx, cfg.GetConnectionURI(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error dialing grpc server: %w", err)
 	}
@@ -2,6 +2,7 @@ package connect_test
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"testing"
 	"time"
@@ -53,6 +54,15 @@ func TestConfig(t *testing.T) {
 	}
 }
 
+func TestConfigProxy(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := connect.NewConfig("https://localhost:8721", connect.WithProxy(http.ProxyFromEnvironment))
+	require.NoError(t, err)
+	assert.Equal(t, "passthrough:///localhost:8721", cfg.GetConnectionURI(),
+		"the proxy should connect by the host name")
+}
+
 func TestConnectClient(t *testing.T) {
 	refreshToken := os.Getenv("CONNECT_CLUSTER_IDENTITY_TOKEN")
 	if refreshToken == "" {
@@ -84,6 +94,7 @@ func TestConnectClient(t *testing.T) {
 
 	connectClient, err := connect.NewAuthorizedConnectClient(ctx, connectServerEndpoint, tokenCache.GetToken)
 	require.NoError(t, err, "error creating connect client")
+	t.Cleanup(func() { _ = connectClient.Close() })
 
 	stream, err := connectClient.Subscribe(ctx, &connect.SubscribeRequest{})
 	require.NoError(t, err, "error subscribing")
@@ -4,8 +4,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc"
@@ -17,20 +19,61 @@ type Config struct {
 	connectionURI string
 	// requireTLS is whether TLS should be used or cleartext
 	requireTLS bool
+	// tlsConfig is the TLS config used if TLS is required, nil for the default one
+	tlsConfig *tls.Config
+	// proxy returns the proxy to connect through, nil to use the gRPC default proxy from the environment
+	proxy ProxyFunc
+	// dialOptions are the additional dial options provided by the caller
+	dialOptions []grpc.DialOption
 	// opts are additional options to pass to the gRPC client
 	opts []grpc.DialOption
 }
 
+// ProxyFunc returns the URL of the proxy to use for the request, or nil if no proxy should be used.
+// See http.ProxyFromEnvironment.
+type ProxyFunc func(*http.Request) (*url.URL, error)
+
+// Option configures the connect client
+type Option func(*Config)
+
+// WithTLSConfig sets the TLS config used to connect to https:// endpoints and https:// proxies,
+// i.e. to trust a private CA or present a client certificate
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Config) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithProxy sets the function that returns the HTTP proxy to tunnel the connection through with HTTP CONNECT.
+// By default, gRPC uses the proxy from the HTTPS_PROXY and NO_PROXY environment variables.
+func WithProxy(proxy ProxyFunc) Option {
+	return func(c *Config) {
+		c.proxy = proxy
+	}
+}
+
+// WithDialOptions sets additional gRPC dial options, i.e. interceptors
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *Config) {
+		c.dialOptions = append(c.dialOptions, opts...)
+	}
+}
+
 // NewConfig returns a new Config from an endpoint string, that has to be in a URL format.
 // The endpoint can be either http:// or https:// that will be used to determine whether TLS should be used.
 // if port is not specified, it will be inferred from the scheme (80 for http, 443 for https).
-func NewConfig(endpoint string) (*Config, error) {
+func NewConfig(endpoint string, opts ...Option) (*Config, error) {
 	c := new(Config)
+	for _, opt := range opts {
+		opt(c)
+	}
 	err := c.parseEndpoint(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("invalid endpoint: %w", err)
 	}
 	c.buildTLSOptions()
+	c.buildProxyOptions()
+	c.opts = append(c.opts, c.dialOptions...)
 	return c, nil
 }
 
@@ -55,13 +98,38 @@ func (c *Config) GetDialOptions() []grpc.DialOption {
 func (c *Config) buildTLSOptions() {
 	creds := insecure.NewCredentials()
 	if c.requireTLS {
-		creds = credentials.NewTLS(&tls.Config{
-			MinVersion: tls.VersionTLS12,
-		})
+		creds = credentials.NewTLS(c.newTLSConfig())
 	}
 	c.opts = append(c.opts, grpc.WithTransportCredentials(creds))
 }
 
+// newTLSConfig returns a copy of the configured TLS config, or the default one
+func (c *Config) newTLSConfig() *tls.Config {
+	if c.tlsConfig == nil {
+		return &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	tlsConfig := c.tlsConfig.Clone()
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	return tlsConfig
+}
+
+// buildProxyOptions replaces the gRPC default proxy handling with the configured proxy.
+// The endpoint is not resolved by gRPC then, so that the proxy is selected and connects by the host name.
+func (c *Config) buildProxyOptions() {
+	if c.proxy == nil {
+		return
+	}
+
+	scheme := "http"
+	if c.requireTLS {
+		scheme = "https"
+	}
+	c.connectionURI = "passthrough:///" + strings.TrimPrefix(c.connectionURI, "dns:")
+	c.opts = append(c.opts, grpc.WithContextDialer(newProxyDialer(scheme, c.proxy, c.newTLSConfig())))
+}
+
 func (c *Config) parseEndpoint(endpoint string) error {
 	u, err := url.Parse(endpoint)
 	if err != nil {
@@ -0,0 +1,123 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// Pool shares the gRPC connections between the connect clients of the same endpoint.
+// Each client authorizes its calls with its own token, so the clients of different clusters may share a connection.
+type Pool struct {
+	opts []Option
+
+	mx    sync.Mutex
+	conns map[string]*pooledConn
+}
+
+type pooledConn struct {
+	conn *grpc.ClientConn
+	refs int
+}
+
+// NewPool creates a new connection pool, the options are applied to all the connections
+func NewPool(opts ...Option) *Pool {
+	return &Pool{
+		opts:  opts,
+		conns: make(map[string]*pooledConn),
+	}
+}
+
+// NewAuthorizedConnectClient creates a new connect client that reuses the pooled connection to the endpoint,
+// or dials a new one, and authorizes requests with the token from the provider.
+// The connection is closed once all the clients using it are closed.
+func (p *Pool) NewAuthorizedConnectClient(
+	ctx context.Context,
+	endpoint string,
+	tokenProvider TokenProviderFn,
+) (Client, error) {
+	cfg, err := NewConfig(endpoint, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	key := poolKey(cfg)
+	conn, err := p.acquire(ctx, key, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return &pooledClient{
+		ConnectClient: NewConnectClient(conn),
+		creds:         grpc.PerRPCCredentials(newClient(cfg, tokenProvider)),
+		release: func() (err error) {
+			once.Do(func() { err = p.release(key) })
+			return err
+		},
+	}, nil
+}
+
+// Len returns the number of the open pooled connections
+func (p *Pool) Len() int {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return len(p.conns)
+}
+
+func poolKey(cfg *Config) string {
+	return fmt.Sprintf("%s tls=%t", cfg.GetConnectionURI(), cfg.RequireTLS())
+}
+
+func (p *Pool) acquire(ctx context.Context, key string, cfg *Config) (*grpc.ClientConn, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if pc, ok := p.conns[key]; ok {
+		pc.refs++
+		return pc.conn, nil
+	}
+
+	conn, err := dial(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[key] = &pooledConn{conn: conn, refs: 1}
+	return conn, nil
+}
+
+func (p *Pool) release(key string) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	pc, ok := p.conns[key]
+	if !ok {
+		return nil
+	}
+	pc.refs--
+	if pc.refs > 0 {
+		return nil
+	}
+	delete(p.conns, key)
+	return pc.conn.Close()
+}
+
+// pooledClient passes its credentials with each call, as the connection is shared
+type pooledClient struct {
+	ConnectClient
+	creds   grpc.CallOption
+	release func() error
+}
+
+// Subscribe implements ConnectClient
+func (c *pooledClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Connect_SubscribeClient, error) {
+	return c.ConnectClient.Subscribe(ctx, in, append(opts, c.creds)...)
+}
+
+// Close implements Client, the shared connection is closed once it is no longer used
+func (c *pooledClient) Close() error {
+	return c.release()
+}
@@ -0,0 +1,39 @@
+package connect_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/zero-sdk/connect"
+)
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tokenProvider := func(context.Context, time.Duration) (string, error) { return "token", nil }
+
+	pool := connect.NewPool()
+	c1, err := pool.NewAuthorizedConnectClient(ctx, "http://localhost:8721", tokenProvider)
+	require.NoError(t, err)
+	c2, err := pool.NewAuthorizedConnectClient(ctx, "http://localhost:8721/", tokenProvider)
+	require.NoError(t, err)
+	c3, err := pool.NewAuthorizedConnectClient(ctx, "http://localhost:8722", tokenProvider)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pool.Len(), "clients of the same endpoint should share the connection")
+
+	require.NoError(t, c1.Close())
+	require.NoError(t, c1.Close(), "closing twice should be a no-op")
+	assert.Equal(t, 2, pool.Len(), "connection is still used")
+
+	require.NoError(t, c2.Close())
+	require.NoError(t, c3.Close())
+	assert.Zero(t, pool.Len())
+
+	_, err = pool.NewAuthorizedConnectClient(ctx, "localhost:8721", tokenProvider)
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+package connect
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// newProxyDialer returns the gRPC dialer, that tunnels the connections with HTTP CONNECT
+// through the proxy selected for the address, or connects directly if there is none.
+// The connections to https:// proxies are verified with the given TLS config.
+func newProxyDialer(scheme string, proxy ProxyFunc, tlsConfig *tls.Config) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: scheme, Host: addr}})
+		if err != nil {
+			return nil, fmt.Errorf("get proxy: %w", err)
+		}
+
+		var d net.Dialer
+		if proxyURL == nil {
+			return d.DialContext(ctx, "tcp", addr)
+		}
+
+		conn, err := dialProxy(ctx, &d, proxyURL, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("dial proxy: %w", err)
+		}
+
+		conn, err = proxyConnect(ctx, conn, proxyURL, addr)
+		if err != nil {
+			return nil, fmt.Errorf("proxy connect: %w", err)
+		}
+		return conn, nil
+	}
+}
+
+func dialProxy(ctx context.Context, d *net.Dialer, proxyURL *url.URL, tlsConfig *tls.Config) (net.Conn, error) {
+	host, port := proxyURL.Hostname(), proxyURL.Port()
+	switch proxyURL.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "http" {
+		return conn, nil
+	}
+
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ServerName = host
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// proxyConnect requests the proxy to establish the tunnel to the address
+func proxyConnect(ctx context.Context, conn net.Conn, proxyURL *url.URL, addr string) (_ net.Conn, err error) {
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is the connection, that has some data read ahead into the buffer
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
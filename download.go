@@ -1,10 +1,9 @@
 package zerosdk
 
 import (
-	"bytes"
 	"compress/gzip"
 	"context"
-	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -13,7 +12,10 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/pomerium/zero-sdk/apierror"
 	cluster_api "github.com/pomerium/zero-sdk/cluster"
@@ -22,61 +24,218 @@ import (
 const (
 	maxErrorResponseBodySize = 2 << 14 // 32kb
 	maxUncompressedBlobSize  = 2 << 30 // 1gb
+
+	// acceptEncoding lists the supported content encodings, zstd is preferred as it compresses the bundles better
+	acceptEncoding = "zstd, gzip;q=0.9"
 )
 
 // DownloadClusterResourceBundle downloads given cluster resource bundle to given writer.
+// The content is verified against the checksums advertised by the cloud and the storage,
+// a mismatch is reported as a terminal ApplyError with the invalid_bundle source,
+// after the bundle was already written to dst.
+// If the connection drops mid-download, the download is resumed from the last byte received
+// with a ranged request, refreshing the signed download URL if it has expired meanwhile.
+// The download is only resumed if the bundle was not updated since it started.
+//
+// Concurrent calls for the same bundle and conditional that are made before the bundle body
+// starts arriving share a single download: it is streamed to the writer of the first call,
+// and spooled to a temporary file for the others only if there are any.
+// The downloads with a progress callback or a bandwidth limit are not shared, as these apply to the transfer.
 func (api *API) DownloadClusterResourceBundle(
 	ctx context.Context,
 	dst io.Writer,
 	id string,
 	current *DownloadConditional,
+	opts ...DownloadOption,
 ) (*DownloadResult, error) {
-	req, err := api.getDownloadRequest(ctx, id, current)
-	if err != nil {
-		return nil, fmt.Errorf("get download request: %w", err)
+	cfg := newDownloadConfig(opts...)
+	if !cfg.shared() {
+		return api.downloadClusterResourceBundle(ctx, dst, id, current, cfg)
 	}
+	return api.sharedDownload(ctx, dst, id, current, cfg)
+}
+
+// downloadClusterResourceBundle streams the bundle to dst, see DownloadClusterResourceBundle
+func (api *API) downloadClusterResourceBundle(
+	ctx context.Context,
+	dst io.Writer,
+	id string,
+	current *DownloadConditional,
+	cfg *downloadConfig,
+) (_ *DownloadResult, err error) {
+	ctx, span := api.tracer.Start(ctx, "bundle.download",
+		trace.WithAttributes(attribute.String("zero.bundle_id", id)),
+	)
+	defer func() { endSpan(span, err) }()
 
-	resp, err := api.cfg.httpClient.Do(req.Request)
+	start := time.Now()
+	startedAt := api.cfg.clock.Now()
+	defer func() {
+		if err != nil {
+			api.metrics.recordDownload(ctx, start, downloadResultError, 0)
+		}
+	}()
+
+	req, resp, err := api.requestBundle(ctx, id, current)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	logger := api.downloadLogger(id, resp)
+
 	if resp.StatusCode == http.StatusNotModified {
+		logger.Debug().Msg("bundle not modified")
+		span.SetAttributes(attribute.Bool("zero.bundle.not_modified", true))
+		api.metrics.recordDownload(ctx, start, downloadResultNotModified, 0)
 		return &DownloadResult{NotModified: true}, nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, httpDownloadError(ctx, resp)
-	}
+	body := api.newResumableBody(ctx, id, resp, logger)
+	defer body.Close()
 
-	var r io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		zr, err := gzip.NewReader(r)
-		if err != nil {
-			return nil, fmt.Errorf("gzip reader: %w", err)
+	var raw io.Reader = body
+	if cfg.bytesPerSecond > 0 {
+		raw = &throttledReader{ctx: ctx, r: raw, bucket: newTokenBucket(api.cfg.clock, cfg.bytesPerSecond)}
+	}
+	if cfg.progress != nil {
+		raw = &progressReader{
+			r:        raw,
+			clock:    api.cfg.clock,
+			start:    startedAt,
+			fn:       cfg.progress,
+			progress: DownloadProgress{Total: resp.ContentLength},
 		}
-		defer zr.Close()
+	}
 
-		r = io.LimitReader(zr, maxUncompressedBlobSize)
+	verifier := newBundleVerifier(logger, req.Checksum, resp)
+	encoding := resp.Header.Get("Content-Encoding")
+	r, err := newContentDecoder(encoding, verifier.rawReader(raw))
+	if err != nil {
+		return nil, err
 	}
+	defer r.Close()
 
-	_, err = io.Copy(dst, r)
+	n, err := io.Copy(io.MultiWriter(dst, verifier.contentWriter()), io.LimitReader(r, maxUncompressedBlobSize))
 	if err != nil {
 		return nil, fmt.Errorf("write body: %w", err)
 	}
+	span.SetAttributes(
+		attribute.Int64("zero.bundle.size", n),
+		attribute.Int64("zero.bundle.compressed_size", body.offset),
+		attribute.String("zero.bundle.content_encoding", encoding),
+		attribute.Int("zero.bundle.resumes", body.resumes),
+	)
+
+	// the checksum comes along with the cached download URL, so it may be of the previous bundle version
+	if verifier.ExpectsContent() && !verifier.ContentMatches(req.Checksum) {
+		params, err := api.updateBundleDownloadParams(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("refresh bundle checksum: %w", err)
+		}
+		if verifier.ContentMatches(params.Checksum) {
+			verifier.SkipContent()
+		}
+	}
+	if err := verifier.Verify(); err != nil {
+		logger.Error().Err(err).Msg("bundle verification failed")
+		if rejected, condErr := newConditionalFromResponse(resp); condErr == nil {
+			err = &rejectedBundleError{conditional: rejected, err: err}
+		}
+		return nil, err
+	}
 
 	updated, err := newConditionalFromResponse(resp)
 	if err != nil {
 		return nil, fmt.Errorf("cannot obtain cache conditions from response: %w", err)
 	}
+	api.metrics.recordDownload(ctx, start, downloadResultModified, n)
+	logger.Debug().
+		Int64("size", n).
+		Int64("compressed_size", body.offset).
+		Str("content_encoding", encoding).
+		Msg("bundle downloaded")
 
 	return &DownloadResult{
 		DownloadConditional: updated,
 		Metadata:            extractMetadata(resp.Header, req.CaptureHeaders),
+		Digest:              verifier.Digest(),
+		ContentEncoding:     encoding,
+		CompressedSize:      body.offset,
+		Size:                n,
 	}, nil
 }
 
+// errUnsupportedEncoding is returned when the storage served the bundle with an encoding that was not requested
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// newContentDecoder returns the reader that decodes the body served with given Content-Encoding
+func newContentDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip reader: %w", err)
+		}
+		return zr, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(maxUncompressedBlobSize),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("zstd reader: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+	}
+}
+
+// requestBundle requests the bundle from the storage, the response is either 200 or 304.
+// If the storage rejects the signed URL, i.e. because it has expired or the clock is skewed,
+// the URL is invalidated and the request is retried once with a fresh one.
+func (api *API) requestBundle(
+	ctx context.Context,
+	id string,
+	current *DownloadConditional,
+) (*downloadRequest, *http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := api.getDownloadRequest(ctx, id, current)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get download request: %w", err)
+		}
+
+		resp, err := api.downloadClient.Do(req.Request)
+		if err != nil {
+			return nil, nil, fmt.Errorf("do request: %w", err)
+		}
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotModified {
+			return req, resp, nil
+		}
+
+		logger := api.downloadLogger(id, resp)
+		dlErr := httpDownloadError(logger, id, resp)
+		_ = resp.Body.Close()
+		if attempt > 0 || !dlErr.isSignedURLError() {
+			return nil, nil, dlErr
+		}
+
+		logger.Info().Err(dlErr).Msg("signed download URL rejected, refreshing")
+		trace.SpanFromContext(ctx).AddEvent("refresh_url")
+		api.downloadURLCache.Delete(id)
+	}
+}
+
+func (api *API) downloadLogger(id string, resp *http.Response) zerolog.Logger {
+	return api.logger.With().
+		Str("bundle_id", id).
+		Str("response_id", responseID(resp)).
+		Logger()
+}
+
 type downloadRequest struct {
 	*http.Request
 	cluster_api.DownloadCacheEntry
@@ -92,7 +251,7 @@ func (api *API) getDownloadRequest(ctx context.Context, id string, current *Down
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
-	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
 
 	err = current.SetHeaders(req)
 	if err != nil {
@@ -114,8 +273,34 @@ func (api *API) getDownloadParams(ctx context.Context, id string) (*cluster_api.
 	return api.updateBundleDownloadParams(ctx, id)
 }
 
+// updateBundleDownloadParams requests a new download URL, the concurrent requests for the same bundle are shared
 func (api *API) updateBundleDownloadParams(ctx context.Context, id string) (*cluster_api.DownloadCacheEntry, error) {
-	now := time.Now()
+	for {
+		ch := api.downloadParams.DoChan(id, func() (any, error) {
+			return api.fetchBundleDownloadParams(ctx, id)
+		})
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case res := <-ch:
+			if res.Err != nil {
+				if res.Shared && isCanceled(res.Err) && ctx.Err() == nil {
+					// the caller that made the request gave up
+					continue
+				}
+				return nil, res.Err
+			}
+			param := *res.Val.(*cluster_api.DownloadCacheEntry)
+			return &param, nil
+		}
+	}
+}
+
+func (api *API) fetchBundleDownloadParams(ctx context.Context, id string) (_ *cluster_api.DownloadCacheEntry, err error) {
+	ctx, span := api.startSpan(ctx, "downloadClusterResourceBundle", attribute.String("zero.bundle_id", id))
+	defer func() { endSpan(span, err) }()
+
+	now := api.cfg.clock.Now()
 
 	resp, err := apierror.CheckResponse[cluster_api.DownloadBundleResponse](
 		api.cluster.DownloadClusterResourceBundleWithResponse(ctx, id),
@@ -139,6 +324,9 @@ func (api *API) updateBundleDownloadParams(ctx context.Context, id string) (*clu
 		ExpiresAt:      now.Add(time.Duration(expiresSeconds) * time.Second),
 		CaptureHeaders: resp.CaptureMetadataHeaders,
 	}
+	if resp.Checksum != nil {
+		param.Checksum = *resp.Checksum
+	}
 	api.downloadURLCache.Set(id, param)
 	return &param, nil
 }
@@ -151,6 +339,14 @@ type DownloadResult struct {
 	*DownloadConditional
 	// Metadata contains the metadata of the downloaded bundle
 	Metadata map[string]string
+	// Digest is the digest of the bundle content as written to the destination, i.e. sha256:<hex>
+	Digest string
+	// ContentEncoding is the encoding the bundle was served with, empty if it was not compressed
+	ContentEncoding string
+	// CompressedSize is the number of bytes received, i.e. before decompression
+	CompressedSize int64
+	// Size is the number of bytes written to the destination
+	Size int64
 }
 
 type DownloadConditional struct {
@@ -188,43 +384,22 @@ func newConditionalFromResponse(resp *http.Response) (*DownloadConditional, erro
 	return c, nil
 }
 
-type xmlError struct {
-	XMLName xml.Name `xml:"Error"`
-	Code    string   `xml:"Code"`
-	Message string   `xml:"Message"`
-	Details string   `xml:"Details"`
-}
-
-func (e xmlError) Error() string {
-	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+// responseIDHeaders are the headers the storage providers identify the response with
+var responseIDHeaders = []string{
+	"X-Request-Id",
+	"X-Amz-Request-Id",
+	"X-Guploader-Uploadid",
+	"X-Ms-Request-Id",
 }
 
-func tryXMLError(body []byte) (bool, error) {
-	var xmlErr xmlError
-	err := xml.Unmarshal(body, &xmlErr)
-	if err != nil {
-		return false, fmt.Errorf("unmarshal xml error: %w", err)
-	}
-
-	return true, xmlErr
-}
-
-func httpDownloadError(ctx context.Context, resp *http.Response) error {
-	var buf bytes.Buffer
-	_, err := io.Copy(&buf, io.LimitReader(resp.Body, maxErrorResponseBodySize))
-
-	if isXML(resp.Header.Get("Content-Type")) {
-		ok, err := tryXMLError(buf.Bytes())
-		if ok {
-			return err
+// responseID returns the storage provider response identifier, that is useful when reporting issues
+func responseID(resp *http.Response) string {
+	for _, h := range responseIDHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			return v
 		}
 	}
-
-	log.Ctx(ctx).Debug().Err(err).
-		Str("error", resp.Status).
-		Str("body", buf.String()).Msg("bundle download error")
-
-	return fmt.Errorf("download error: %s", resp.Status)
+	return ""
 }
 
 // isXML parses content-type for application/xml
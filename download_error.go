@@ -0,0 +1,128 @@
+package zerosdk
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+)
+
+// DownloadError is returned when the storage responds to the bundle download with an error
+type DownloadError struct {
+	// BundleID is the ID of the bundle being downloaded
+	BundleID string
+	// StatusCode is the HTTP status code of the storage response
+	StatusCode int
+	// Code is the storage error code, i.e. NoSuchKey, empty if the storage did not return an XML error
+	Code string
+	// Message is the storage error message
+	Message string
+	// Details are the storage error details, if any
+	Details string
+	// Body is the beginning of the response body, if the storage did not return an XML error
+	Body string
+	// ResponseID identifies the response with the storage provider, that is useful when reporting issues
+	ResponseID string
+}
+
+// Error implements error for DownloadError
+func (e *DownloadError) Error() string {
+	status := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Code == "" {
+		return fmt.Sprintf("download bundle %s: %s", e.BundleID, status)
+	}
+	return fmt.Sprintf("download bundle %s: %s: %s: %s", e.BundleID, status, e.Code, e.Message)
+}
+
+// retryableErrorCodes are the storage error codes of the transient failures
+var retryableErrorCodes = map[string]bool{
+	"InternalError":      true,
+	"OperationAborted":   true,
+	"RequestTimeout":     true,
+	"ServerBusy":         true,
+	"ServiceUnavailable": true,
+	"SlowDown":           true,
+}
+
+// Retryable reports whether downloading the bundle again later may succeed.
+// The signed URL errors are not retryable, as the download was already retried with a fresh URL.
+func (e *DownloadError) Retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout,
+		e.StatusCode == http.StatusTooManyRequests,
+		e.StatusCode >= http.StatusInternalServerError:
+		return true
+	default:
+		return retryableErrorCodes[e.Code]
+	}
+}
+
+// IsTerminal implements apierror.TerminalError, the errors that are not retryable are terminal
+func (e *DownloadError) IsTerminal() bool {
+	return !e.Retryable()
+}
+
+// FailureSource returns the failure source to report the bundle status with
+func (e *DownloadError) FailureSource() cluster_api.BundleStatusFailureSource {
+	return cluster_api.DownloadError
+}
+
+// signedURLErrorCodes are the storage error codes returned for the expired or otherwise invalid signed URLs
+var signedURLErrorCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AuthenticationFailed":  true,
+	"ExpiredToken":          true,
+	"RequestExpired":        true,
+	"SignatureDoesNotMatch": true,
+}
+
+// isSignedURLError reports whether the storage rejected the signed URL, so that a fresh one may succeed
+func (e *DownloadError) isSignedURLError() bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	case http.StatusBadRequest:
+		return signedURLErrorCodes[e.Code]
+	default:
+		return false
+	}
+}
+
+// storageError is the XML error the cloud storage providers respond with
+type storageError struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+	Details string   `xml:"Details"`
+}
+
+func httpDownloadError(logger zerolog.Logger, id string, resp *http.Response) *DownloadError {
+	var buf bytes.Buffer
+	_, readErr := io.Copy(&buf, io.LimitReader(resp.Body, maxErrorResponseBodySize))
+
+	dlErr := &DownloadError{
+		BundleID:   id,
+		StatusCode: resp.StatusCode,
+		ResponseID: responseID(resp),
+	}
+
+	var xmlErr storageError
+	if isXML(resp.Header.Get("Content-Type")) && xml.Unmarshal(buf.Bytes(), &xmlErr) == nil {
+		dlErr.Code = xmlErr.Code
+		dlErr.Message = xmlErr.Message
+		dlErr.Details = xmlErr.Details
+		return dlErr
+	}
+
+	dlErr.Body = strings.ToValidUTF8(buf.String(), "")
+	logger.Debug().Err(readErr).
+		Str("error", resp.Status).
+		Str("body", dlErr.Body).Msg("bundle download error")
+	return dlErr
+}
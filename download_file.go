@@ -0,0 +1,75 @@
+package zerosdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+)
+
+// DownloadClusterResourceBundleToFile downloads given cluster resource bundle to the file at path.
+// The bundle is downloaded to a temporary file in the same directory, that is synced to disk
+// and renamed over path only once the download was verified, so path either keeps the previous bundle
+// or holds the complete new one. The file is left untouched if the bundle was not modified.
+// The file mode of the replaced file is preserved, new files are only readable by the owner.
+func (api *API) DownloadClusterResourceBundleToFile(
+	ctx context.Context,
+	path string,
+	id string,
+	current *DownloadConditional,
+	opts ...DownloadOption,
+) (_ *DownloadResult, err error) {
+	fd, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, NewApplyError(cluster_api.IoError, fmt.Errorf("create temp file: %w", err))
+	}
+	defer func() {
+		// no-op after the successful rename
+		_ = fd.Close()
+		_ = os.Remove(fd.Name())
+	}()
+
+	result, err := api.DownloadClusterResourceBundle(ctx, fd, id, current, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if result.NotModified {
+		return result, nil
+	}
+
+	if err := syncAndClose(fd, path); err != nil {
+		return nil, NewApplyError(cluster_api.IoError, err)
+	}
+	if err := os.Rename(fd.Name(), path); err != nil {
+		return nil, NewApplyError(cluster_api.IoError, fmt.Errorf("rename temp file: %w", err))
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return nil, NewApplyError(cluster_api.IoError, fmt.Errorf("sync dir: %w", err))
+	}
+	return result, nil
+}
+
+// syncAndClose copies the mode of the file being replaced, and flushes the temp file to disk
+func syncAndClose(fd *os.File, path string) error {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if err := fd.Chmod(info.Mode().Perm()); err != nil {
+			return fmt.Errorf("chmod temp file: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	if err := fd.Sync(); err != nil {
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+	if err := fd.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	return nil
+}
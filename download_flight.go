@@ -0,0 +1,261 @@
+package zerosdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultDownloadConcurrency is the number of bundles DownloadClusterResourceBundles downloads at once by default
+const DefaultDownloadConcurrency = 4
+
+// downloadFlight is a bundle download shared by the concurrent callers.
+// The caller that starts the flight streams the bundle straight to its destination,
+// the other callers may only join it until the first byte of the bundle is written,
+// and are served from a temporary file the bundle is spooled to.
+type downloadFlight struct {
+	done chan struct{}
+	// refs is the number of the callers waiting for the flight, guarded by API.downloadsMx
+	refs int
+
+	// spool holds the downloaded bundle, nil unless some caller joined the flight;
+	// set once done is closed
+	spool  *os.File
+	result *DownloadResult
+	err    error
+}
+
+// errFlightAborted is reported to the callers that joined the flight,
+// if it failed for the reasons specific to the caller that started it
+var errFlightAborted = errors.New("shared bundle download aborted")
+
+// sharedDownload joins the in-flight download of the same bundle, or starts a new one
+func (api *API) sharedDownload(
+	ctx context.Context,
+	dst io.Writer,
+	id string,
+	current *DownloadConditional,
+	cfg *downloadConfig,
+) (*DownloadResult, error) {
+	key := id
+	if current != nil {
+		key += "\x00" + current.ETag + "\x00" + current.LastModified
+	}
+
+	for {
+		api.downloadsMx.Lock()
+		f, shared := api.downloads[key]
+		if !shared {
+			f = &downloadFlight{done: make(chan struct{})}
+			api.downloads[key] = f
+		}
+		f.refs++
+		api.downloadsMx.Unlock()
+
+		if !shared {
+			return api.leadFlight(ctx, dst, key, f, id, current, cfg)
+		}
+
+		api.logger.Debug().Str("bundle_id", id).Msg("joined in-flight bundle download")
+		result, err := api.copyFlight(ctx, f, dst)
+		if errors.Is(err, errFlightAborted) || (isCanceled(err) && ctx.Err() == nil) {
+			// the caller that started the download gave up, or could not share it
+			continue
+		}
+		return result, err
+	}
+}
+
+// leadFlight downloads the bundle to dst, spooling it for the callers that joined the flight
+func (api *API) leadFlight(
+	ctx context.Context,
+	dst io.Writer,
+	key string,
+	f *downloadFlight,
+	id string,
+	current *DownloadConditional,
+	cfg *downloadConfig,
+) (*DownloadResult, error) {
+	defer api.releaseFlight(f)
+
+	w := &flightWriter{api: api, key: key, id: id, f: f, dst: dst, tempDir: cfg.tempDir}
+	result, err := api.downloadClusterResourceBundle(ctx, w, id, current, cfg)
+
+	api.downloadsMx.Lock()
+	if api.downloads[key] == f {
+		delete(api.downloads, key)
+	}
+	f.spool = w.spool
+	api.downloadsMx.Unlock()
+
+	f.result, f.err = result, err
+	if w.dstErr != nil || w.spoolErr != nil {
+		f.err = errFlightAborted
+	}
+	close(f.done)
+	return result, err
+}
+
+// copyFlight waits for the flight to complete, and copies the bundle to dst
+func (api *API) copyFlight(ctx context.Context, f *downloadFlight, dst io.Writer) (*DownloadResult, error) {
+	defer api.releaseFlight(f)
+
+	select {
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	case <-f.done:
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	result := *f.result
+	result.Metadata = make(map[string]string, len(f.result.Metadata))
+	for k, v := range f.result.Metadata {
+		result.Metadata[k] = v
+	}
+	if result.NotModified || result.Size == 0 {
+		return &result, nil
+	}
+
+	// the callers read the spool concurrently, so the offset is not shared
+	if _, err := io.Copy(dst, io.NewSectionReader(f.spool, 0, result.Size)); err != nil {
+		return nil, fmt.Errorf("write body: %w", err)
+	}
+	return &result, nil
+}
+
+func (api *API) releaseFlight(f *downloadFlight) {
+	api.downloadsMx.Lock()
+	defer api.downloadsMx.Unlock()
+
+	f.refs--
+	if f.refs == 0 && f.spool != nil {
+		_ = f.spool.Close()
+		_ = os.Remove(f.spool.Name())
+	}
+}
+
+// flightWriter writes the bundle to the destination of the caller that started the flight,
+// and to the spool once it is known that some other caller joined it
+type flightWriter struct {
+	api *API
+	key string
+	id  string
+	f   *downloadFlight
+	dst io.Writer
+	// tempDir is where the spool is created
+	tempDir string
+
+	started  bool
+	spool    *os.File
+	spoolErr error
+	dstErr   error
+}
+
+// Write implements io.Writer
+func (w *flightWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.startSpool()
+	}
+	if w.spool != nil && w.spoolErr == nil {
+		if _, err := w.spool.Write(p); err != nil {
+			w.spoolErr = err
+			w.api.logger.Warn().Err(err).Str("bundle_id", w.id).Msg("failed to spool shared bundle download")
+		}
+	}
+
+	n, err := w.dst.Write(p)
+	if err != nil {
+		w.dstErr = err
+	}
+	return n, err
+}
+
+// startSpool closes the flight to the new callers, as the bytes written so far are not kept,
+// and creates the spool if any caller already joined it
+func (w *flightWriter) startSpool() {
+	w.api.downloadsMx.Lock()
+	if w.api.downloads[w.key] == w.f {
+		delete(w.api.downloads, w.key)
+	}
+	joined := w.f.refs > 1
+	w.api.downloadsMx.Unlock()
+
+	if !joined {
+		return
+	}
+	w.spool, w.spoolErr = os.CreateTemp(w.tempDir, "zero-bundle-*")
+	if w.spoolErr != nil {
+		w.api.logger.Warn().Err(w.spoolErr).Str("bundle_id", w.id).Msg("failed to spool shared bundle download")
+	}
+}
+
+// BundleDownload is a bundle to download with DownloadClusterResourceBundles
+type BundleDownload struct {
+	// ID is the bundle ID
+	ID string
+	// Dst is where the bundle is written to
+	Dst io.Writer
+	// Current is the conditional of the bundle the caller already has, may be nil
+	Current *DownloadConditional
+	// Options configure the download
+	Options []DownloadOption
+}
+
+// DownloadClusterResourceBundles downloads the bundles concurrently, at most concurrency at once,
+// or DefaultDownloadConcurrency if it is not positive.
+// The results are in the order of the downloads, and are nil for the bundles that failed to download.
+// The returned error combines the errors of all failed downloads.
+func (api *API) DownloadClusterResourceBundles(
+	ctx context.Context,
+	downloads []BundleDownload,
+	concurrency int,
+) ([]*DownloadResult, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+
+	results := make([]*DownloadResult, len(downloads))
+	errs := make([]error, len(downloads))
+
+	// a failed download does not cancel the others
+	var eg errgroup.Group
+	eg.SetLimit(concurrency)
+	for i, d := range downloads {
+		i, d := i, d
+		eg.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				errs[i] = fmt.Errorf("bundle %s: %w", d.ID, context.Cause(ctx))
+				return nil
+			}
+			result, err := api.DownloadClusterResourceBundle(ctx, d.Dst, d.ID, d.Current, d.Options...)
+			if err != nil {
+				errs[i] = fmt.Errorf("bundle %s: %w", d.ID, err)
+				return nil
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	var err error
+	for _, e := range errs {
+		if e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+	return results, err
+}
+
+// isCanceled returns true if the error is caused by a canceled context
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
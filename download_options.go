@@ -0,0 +1,151 @@
+package zerosdk
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pomerium/zero-sdk/clock"
+)
+
+// DownloadOption configures a bundle download
+type DownloadOption func(*downloadConfig)
+
+type downloadConfig struct {
+	progress       func(DownloadProgress)
+	bytesPerSecond int64
+	// tempDir is where the shared download is spooled to, os.TempDir if empty
+	tempDir string
+}
+
+func newDownloadConfig(opts ...DownloadOption) *downloadConfig {
+	cfg := new(downloadConfig)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// shared reports whether the download may be shared with the concurrent calls,
+// that is not the case if the options apply to the transfer itself
+func (cfg *downloadConfig) shared() bool {
+	return cfg.progress == nil && cfg.bytesPerSecond <= 0
+}
+
+// withDownloadTempDir sets the directory the shared download is spooled to
+func withDownloadTempDir(dir string) DownloadOption {
+	return func(cfg *downloadConfig) {
+		cfg.tempDir = dir
+	}
+}
+
+// DownloadProgress is reported while the bundle is being downloaded
+type DownloadProgress struct {
+	// BytesRead is the number of the body bytes received so far, i.e. before decompression
+	BytesRead int64
+	// Total is the size of the body from Content-Length, -1 if it is unknown
+	Total int64
+	// Elapsed is the time since the download started
+	Elapsed time.Duration
+}
+
+// WithDownloadProgress sets the function that is called after each read of the response body.
+// It is called from the downloading goroutine, so it should return quickly.
+func WithDownloadProgress(fn func(DownloadProgress)) DownloadOption {
+	return func(cfg *downloadConfig) {
+		cfg.progress = fn
+	}
+}
+
+// WithDownloadBandwidthLimit limits the rate the response body is read at, in bytes per second,
+// allowing bursts of up to a second worth of bytes. Zero or negative disables the limit.
+func WithDownloadBandwidthLimit(bytesPerSecond int64) DownloadOption {
+	return func(cfg *downloadConfig) {
+		cfg.bytesPerSecond = bytesPerSecond
+	}
+}
+
+// progressReader reports the progress of reading the body
+type progressReader struct {
+	r     io.Reader
+	clock clock.Clock
+	start time.Time
+	fn    func(DownloadProgress)
+
+	progress DownloadProgress
+}
+
+// Read implements io.Reader
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.progress.BytesRead += int64(n)
+		r.progress.Elapsed = r.clock.Since(r.start)
+		r.fn(r.progress)
+	}
+	return n, err
+}
+
+// tokenBucket limits the rate of the bytes read
+type tokenBucket struct {
+	clock  clock.Clock
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(clk clock.Clock, bytesPerSecond int64) *tokenBucket {
+	return &tokenBucket{
+		clock:  clk,
+		rate:   float64(bytesPerSecond),
+		burst:  int(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   clk.Now(),
+	}
+}
+
+// wait takes n tokens, and waits until the bucket is no longer in debt
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	now := b.clock.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return nil
+	}
+
+	timer := b.clock.NewTimer(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timer.C():
+		return nil
+	}
+}
+
+// throttledReader reads at most at the rate of the token bucket
+type throttledReader struct {
+	ctx    context.Context
+	r      io.Reader
+	bucket *tokenBucket
+}
+
+// Read implements io.Reader
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > r.bucket.burst {
+		p = p[:r.bucket.burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.bucket.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
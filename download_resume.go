@@ -0,0 +1,147 @@
+package zerosdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxDownloadResumes limits how many times an interrupted download is resumed
+const maxDownloadResumes = 5
+
+// resumableBody is the bundle download body, that resumes the interrupted download with a ranged request
+// from the last byte read. The ranges are of the body as served, so the resumed bytes may be decompressed as usual.
+type resumableBody struct {
+	ctx    context.Context
+	api    *API
+	id     string
+	logger zerolog.Logger
+
+	body io.ReadCloser
+	// validator is the strong ETag or Last-Modified of the initial response, used for If-Range,
+	// so that a bundle that was updated meanwhile is not stitched together from two versions
+	validator string
+	// offset is the number of the body bytes read so far
+	offset  int64
+	resumes int
+}
+
+func (api *API) newResumableBody(ctx context.Context, id string, resp *http.Response, logger zerolog.Logger) *resumableBody {
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	return &resumableBody{
+		ctx:       ctx,
+		api:       api,
+		id:        id,
+		logger:    logger,
+		body:      resp.Body,
+		validator: validator,
+	}
+}
+
+// Read implements io.Reader
+func (b *resumableBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	if err == nil || errors.Is(err, io.EOF) {
+		return n, err
+	}
+
+	if resumeErr := b.resume(err); resumeErr != nil {
+		return n, resumeErr
+	}
+	return n, nil
+}
+
+// Close implements io.Closer
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
+
+func (b *resumableBody) resume(cause error) error {
+	if b.ctx.Err() != nil || b.validator == "" || b.resumes >= maxDownloadResumes {
+		return cause
+	}
+	b.resumes++
+
+	b.logger.Info().Err(cause).
+		Int64("offset", b.offset).
+		Int("attempt", b.resumes).
+		Msg("bundle download interrupted, resuming")
+	trace.SpanFromContext(b.ctx).AddEvent("resume", trace.WithAttributes(
+		attribute.Int64("zero.bundle.offset", b.offset),
+	))
+
+	resp, err := b.requestRange()
+	if err != nil {
+		return fmt.Errorf("%w (resume: %v)", cause, err)
+	}
+
+	_ = b.body.Close()
+	b.body = resp.Body
+	return nil
+}
+
+// requestRange requests the rest of the body, refreshing the signed URL if it has expired
+func (b *resumableBody) requestRange() (*http.Response, error) {
+	resp, err := b.doRangeRequest()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		dlErr := httpDownloadError(b.logger, b.id, resp)
+		_ = resp.Body.Close()
+		if !dlErr.isSignedURLError() {
+			return nil, dlErr
+		}
+		b.api.downloadURLCache.Delete(b.id)
+		if resp, err = b.doRangeRequest(); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		drainBody(resp)
+		// the bundle was updated meanwhile, or the storage does not support ranges
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != b.offset {
+		drainBody(resp)
+		return nil, fmt.Errorf("unexpected content range: %q", resp.Header.Get("Content-Range"))
+	}
+	return resp, nil
+}
+
+func (b *resumableBody) doRangeRequest() (*http.Response, error) {
+	req, err := b.api.getDownloadRequest(b.ctx, b.id, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+	req.Header.Set("If-Range", b.validator)
+	return b.api.downloadClient.Do(req.Request)
+}
+
+// contentRangeStart returns the first byte position of the Content-Range header, i.e. bytes 100-199/200
+func contentRangeStart(value string) (int64, bool) {
+	value, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	return start, err == nil
+}
@@ -0,0 +1,584 @@
+package zerosdk_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/apierror"
+	"github.com/pomerium/zero-sdk/clock"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func TestDownloadResume(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 256<<10)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	t.Run("interrupted", func(t *testing.T) {
+		t.Parallel()
+
+		for name, opts := range map[string][]zerotest.BundleOption{
+			"plain": nil,
+			"gzip":  {zerotest.WithBundleGzip()},
+			"zstd":  {zerotest.WithBundleZstd()},
+		} {
+			opts := opts
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				ctx := testContext(t)
+				srv := zerotest.NewServer(t)
+				srv.SetBundle("config", data, opts...)
+				srv.InterruptDownloads("config", 100<<10, 2, nil)
+
+				api := newTestAPI(t, srv)
+
+				var buf bytes.Buffer
+				res, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+				require.NoError(t, err)
+				assert.False(t, res.NotModified)
+				assert.Equal(t, data, buf.Bytes())
+				assert.Equal(t, 1, srv.RequestCount("DownloadClusterResourceBundle"), "download URL should be cached")
+			})
+		}
+	})
+
+	t.Run("signed URL expired", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := testContext(t)
+		clk := clock.NewFake(time.Now())
+		srv := zerotest.NewServer(t, zerotest.WithClock(clk), zerotest.WithDownloadURLTTL(time.Hour))
+		srv.SetBundle("config", data)
+		srv.InterruptDownloads("config", 100<<10, 1, func() { clk.Advance(time.Hour * 2) })
+
+		api := newTestAPI(t, srv)
+
+		var buf bytes.Buffer
+		_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+		require.NoError(t, err)
+		assert.Equal(t, data, buf.Bytes())
+		assert.Equal(t, 2, srv.RequestCount("DownloadClusterResourceBundle"), "download URL should be refreshed")
+	})
+
+	t.Run("bundle updated", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := testContext(t)
+		srv := zerotest.NewServer(t)
+		srv.SetBundle("config", data)
+		srv.InterruptDownloads("config", 100<<10, 1, func() { srv.SetBundle("config", []byte("updated")) })
+
+		api := newTestAPI(t, srv)
+
+		var buf bytes.Buffer
+		_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+		assert.Error(t, err, "the download should not be stitched from two bundle versions")
+	})
+}
+
+func TestDownloadEncoding(t *testing.T) {
+	t.Parallel()
+
+	data := bytes.Repeat([]byte("bundle-data\n"), 1000)
+
+	for _, tc := range []struct {
+		encoding string
+		opts     []zerotest.BundleOption
+	}{
+		{"", nil},
+		{"gzip", []zerotest.BundleOption{zerotest.WithBundleGzip()}},
+		{"zstd", []zerotest.BundleOption{zerotest.WithBundleZstd()}},
+	} {
+		tc := tc
+		t.Run(tc.encoding, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := testContext(t)
+			srv := zerotest.NewServer(t)
+			srv.SetBundle("config", data, tc.opts...)
+
+			api := newTestAPI(t, srv)
+
+			var buf bytes.Buffer
+			res, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+			require.NoError(t, err)
+			assert.Equal(t, data, buf.Bytes())
+			assert.Equal(t, tc.encoding, res.ContentEncoding)
+			assert.Equal(t, int64(len(data)), res.Size)
+			if tc.encoding == "" {
+				assert.Equal(t, res.Size, res.CompressedSize)
+			} else {
+				assert.Less(t, res.CompressedSize, res.Size)
+			}
+		})
+	}
+}
+
+func TestDownloadVerify(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("bundle-data")
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	md5sum := md5.Sum(data)              //nolint:gosec
+	otherMD5 := md5.Sum([]byte("other")) //nolint:gosec
+
+	for _, tc := range []struct {
+		name string
+		opts []zerotest.BundleOption
+		err  bool
+	}{
+		{"checksum", nil, false},
+		{"gzip", []zerotest.BundleOption{zerotest.WithBundleGzip()}, false},
+		{"zstd", []zerotest.BundleOption{zerotest.WithBundleZstd()}, false},
+		{"no checksum", []zerotest.BundleOption{zerotest.WithBundleChecksum("")}, false},
+		{"unsupported checksum", []zerotest.BundleOption{zerotest.WithBundleChecksum("sha3:00")}, false},
+		{"checksum mismatch", []zerotest.BundleOption{zerotest.WithBundleChecksum("sha256:00")}, true},
+		{"content md5", []zerotest.BundleOption{
+			zerotest.WithBundleMetadata(map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md5sum[:])}),
+		}, false},
+		{"content md5 mismatch", []zerotest.BundleOption{
+			zerotest.WithBundleMetadata(map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(otherMD5[:])}),
+		}, true},
+		{"goog hash mismatch", []zerotest.BundleOption{
+			zerotest.WithBundleMetadata(map[string]string{"X-Goog-Hash": "crc32c=AAAAAA==, md5=" + base64.StdEncoding.EncodeToString(md5sum[:])}),
+		}, true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := testContext(t)
+			srv := zerotest.NewServer(t)
+			srv.SetBundle("config", data, tc.opts...)
+
+			api := newTestAPI(t, srv)
+
+			res, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+			if !tc.err {
+				require.NoError(t, err)
+				assert.Equal(t, digest, res.Digest)
+				assert.Equal(t, 1, srv.RequestCount("DownloadClusterResourceBundle"), "download params should not be refreshed")
+				return
+			}
+
+			assert.ErrorIs(t, err, zerosdk.ErrChecksumMismatch)
+			assert.True(t, apierror.IsTerminalError(err), "mismatch should not be retried")
+			var applyErr *zerosdk.ApplyError
+			require.True(t, errors.As(err, &applyErr))
+			assert.Equal(t, cluster_api.InvalidBundle, applyErr.Source)
+		})
+	}
+}
+
+func TestDownloadVerifyUpdated(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("v1"))
+
+	api := newTestAPI(t, srv)
+
+	_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+	require.NoError(t, err)
+
+	// the checksum cached along with the download URL is of the previous version
+	srv.SetBundle("config", []byte("v2"))
+	var buf bytes.Buffer
+	_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", buf.String())
+	assert.Equal(t, 2, srv.RequestCount("DownloadClusterResourceBundle"), "checksum should be refreshed")
+}
+
+func TestDownloadToFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("v1"))
+
+	api := newTestAPI(t, srv)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.bundle")
+	assertFile := func(want string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "temp files should be removed")
+	}
+
+	res, err := api.DownloadClusterResourceBundleToFile(ctx, path, "config", nil)
+	require.NoError(t, err)
+	assertFile("v1")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// not modified
+	require.NoError(t, os.Chmod(path, 0o644))
+	notModified, err := api.DownloadClusterResourceBundleToFile(ctx, path, "config", res.DownloadConditional)
+	require.NoError(t, err)
+	assert.True(t, notModified.NotModified)
+	assertFile("v1")
+
+	// the previous file is kept on failures
+	srv.SetBundle("config", []byte("v2"), zerotest.WithBundleChecksum("sha256:00"))
+	_, err = api.DownloadClusterResourceBundleToFile(ctx, path, "config", res.DownloadConditional)
+	assert.ErrorIs(t, err, zerosdk.ErrChecksumMismatch)
+	assertFile("v1")
+
+	srv.SetBundle("config", []byte("v3"))
+	_, err = api.DownloadClusterResourceBundleToFile(ctx, path, "config", res.DownloadConditional)
+	require.NoError(t, err)
+	assertFile("v3")
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm(), "mode should be preserved")
+
+	_, err = api.DownloadClusterResourceBundleToFile(ctx, path, "missing", nil)
+	assert.Error(t, err)
+	assertFile("v3")
+}
+
+// lineCounter counts the log lines containing the substring
+type lineCounter struct {
+	substr string
+	mx     sync.Mutex
+	n      int
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if bytes.Contains(p, []byte(c.substr)) {
+		c.n++
+	}
+	return len(p), nil
+}
+
+func (c *lineCounter) Count() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.n
+}
+
+func TestDownloadShared(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"), zerotest.WithBundleGzip())
+
+	joined := &lineCounter{substr: "joined in-flight bundle download"}
+	logger := zerolog.New(joined).Level(zerolog.DebugLevel)
+	api := newTestAPI(t, srv, zerosdk.WithLogger(&logger))
+
+	release := srv.HoldDownloads("config")
+	defer release()
+
+	const callers = 5
+	var eg errgroup.Group
+	bufs := make([]bytes.Buffer, callers)
+	download := func(i int) {
+		eg.Go(func() error {
+			res, err := api.DownloadClusterResourceBundle(ctx, &bufs[i], "config", nil)
+			if err == nil && res.Size != int64(len("bundle-data")) {
+				err = fmt.Errorf("unexpected size: %d", res.Size)
+			}
+			return err
+		})
+	}
+
+	download(0)
+	require.Eventually(t, func() bool { return srv.DownloadCount("config") == 1 }, time.Second*5, time.Millisecond*10)
+	for i := 1; i < callers; i++ {
+		download(i)
+	}
+	require.Eventually(t, func() bool { return joined.Count() == callers-1 }, time.Second*5, time.Millisecond*10)
+	release()
+
+	require.NoError(t, eg.Wait())
+	for i := range bufs {
+		assert.Equal(t, "bundle-data", bufs[i].String())
+	}
+	assert.Equal(t, 1, srv.DownloadCount("config"), "download should be shared")
+	assert.Equal(t, 1, srv.RequestCount("DownloadClusterResourceBundle"))
+
+	// the following download is not shared
+	_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, srv.DownloadCount("config"))
+}
+
+func TestDownloadSharedWithoutTempDir(t *testing.T) {
+	// the bundle is only spooled to the temp dir if the download is shared
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	joined := &lineCounter{substr: "joined in-flight bundle download"}
+	logger := zerolog.New(joined).Level(zerolog.DebugLevel)
+	api := newTestAPI(t, srv, zerosdk.WithLogger(&logger))
+
+	var buf bytes.Buffer
+	_, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "bundle-data", buf.String())
+
+	// the caller that joined the flight downloads the bundle on its own, as it could not be spooled
+	release := srv.HoldDownloads("config")
+	defer release()
+
+	var eg errgroup.Group
+	bufs := make([]bytes.Buffer, 2)
+	for i := range bufs {
+		i := i
+		eg.Go(func() error {
+			_, err := api.DownloadClusterResourceBundle(ctx, &bufs[i], "config", nil)
+			return err
+		})
+		if i == 0 {
+			require.Eventually(t, func() bool { return srv.DownloadCount("config") == 2 }, time.Second*5, time.Millisecond*10)
+		}
+	}
+	require.Eventually(t, func() bool { return joined.Count() == 1 }, time.Second*5, time.Millisecond*10)
+	release()
+
+	require.NoError(t, eg.Wait())
+	for i := range bufs {
+		assert.Equal(t, "bundle-data", bufs[i].String())
+	}
+	assert.Equal(t, 3, srv.DownloadCount("config"))
+}
+
+func TestDownloadBundles(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("a", []byte("bundle-a"))
+	srv.SetBundle("b", []byte("bundle-b"), zerotest.WithBundleZstd())
+	srv.SetBundle("c", []byte("bundle-c"))
+
+	api := newTestAPI(t, srv)
+
+	first, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "c", nil)
+	require.NoError(t, err)
+
+	var a, b, c, missing bytes.Buffer
+	results, err := api.DownloadClusterResourceBundles(ctx, []zerosdk.BundleDownload{
+		{ID: "a", Dst: &a},
+		{ID: "missing", Dst: &missing},
+		{ID: "b", Dst: &b},
+		{ID: "c", Dst: &c, Current: first.DownloadConditional},
+	}, 2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bundle missing")
+	require.Len(t, results, 4)
+
+	require.NotNil(t, results[0])
+	assert.Equal(t, "bundle-a", a.String())
+	assert.Nil(t, results[1])
+	require.NotNil(t, results[2])
+	assert.Equal(t, "bundle-b", b.String())
+	require.NotNil(t, results[3])
+	assert.True(t, results[3].NotModified)
+	assert.Zero(t, c.Len())
+}
+
+func TestDownloadSignedURLRefresh(t *testing.T) {
+	t.Parallel()
+
+	t.Run("clock skew", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := testContext(t)
+		storageClock := clock.NewFake(time.Now())
+		srv := zerotest.NewServer(t,
+			zerotest.WithClock(storageClock),
+			zerotest.WithDownloadURLTTL(time.Hour),
+			zerotest.WithTokenTTL(time.Hour*24),
+		)
+		srv.SetBundle("config", []byte("bundle-data"))
+
+		api := newTestAPI(t, srv, zerosdk.WithClock(clock.NewFake(storageClock.Now())))
+
+		_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+		require.NoError(t, err)
+
+		// the cached URL is still valid as far as the client can tell
+		storageClock.Advance(time.Hour * 2)
+		var buf bytes.Buffer
+		_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bundle-data", buf.String())
+		assert.Equal(t, 2, srv.RequestCount("DownloadClusterResourceBundle"), "download URL should be refreshed")
+	})
+
+	t.Run("retried once", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := testContext(t)
+		srv := zerotest.NewServer(t, zerotest.WithDownloadURLTTL(-time.Hour))
+		srv.SetBundle("config", []byte("bundle-data"))
+
+		api := newTestAPI(t, srv)
+
+		_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+		assert.ErrorContains(t, err, "ExpiredToken")
+		assert.Equal(t, 2, srv.RequestCount("DownloadClusterResourceBundle"))
+		assert.Equal(t, 2, srv.DownloadCount("config"))
+	})
+}
+
+func TestDownloadError(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	api := newTestAPI(t, srv)
+
+	_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+	require.NoError(t, err)
+
+	// the download URL is cached, while the bundle is gone from the storage
+	srv.RemoveBundle("config")
+	_, err = api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+	var dlErr *zerosdk.DownloadError
+	require.True(t, errors.As(err, &dlErr), "unexpected error: %v", err)
+	assert.Equal(t, "config", dlErr.BundleID)
+	assert.Equal(t, http.StatusNotFound, dlErr.StatusCode)
+	assert.Equal(t, "NoSuchKey", dlErr.Code)
+	assert.Equal(t, "The specified key does not exist.", dlErr.Message)
+	assert.False(t, dlErr.Retryable())
+	assert.True(t, apierror.IsTerminalError(err), "the non-retryable error should be terminal")
+	assert.Equal(t, cluster_api.DownloadError, dlErr.FailureSource())
+	assert.False(t, apierror.IsTerminalError(fmt.Errorf("download: %w", &zerosdk.DownloadError{StatusCode: http.StatusServiceUnavailable})))
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		srv := zerotest.NewServer(t, zerotest.WithDownloadURLTTL(-time.Hour))
+		srv.SetBundle("config", []byte("bundle-data"))
+
+		api := newTestAPI(t, srv)
+
+		_, err = api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+		var dlErr *zerosdk.DownloadError
+		require.True(t, errors.As(err, &dlErr), "unexpected error: %v", err)
+		assert.Equal(t, http.StatusBadRequest, dlErr.StatusCode)
+		assert.Equal(t, "ExpiredToken", dlErr.Code)
+		assert.False(t, dlErr.Retryable(), "the download was already retried with a fresh URL")
+	})
+}
+
+func TestDownloadProgress(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 256<<10)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", data)
+
+	api := newTestAPI(t, srv)
+
+	var progress []zerosdk.DownloadProgress
+	var buf bytes.Buffer
+	res, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil,
+		zerosdk.WithDownloadProgress(func(p zerosdk.DownloadProgress) { progress = append(progress, p) }),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, data, buf.Bytes())
+
+	require.NotEmpty(t, progress)
+	for i := 1; i < len(progress); i++ {
+		assert.Greater(t, progress[i].BytesRead, progress[i-1].BytesRead)
+		assert.GreaterOrEqual(t, progress[i].Elapsed, progress[i-1].Elapsed)
+	}
+	last := progress[len(progress)-1]
+	assert.Equal(t, int64(len(data)), last.BytesRead)
+	assert.Equal(t, res.CompressedSize, last.Total)
+}
+
+func TestDownloadBandwidthLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	clk := clock.NewFake(time.Now())
+	srv := zerotest.NewServer(t, zerotest.WithClock(clk), zerotest.WithTokenTTL(time.Hour*24))
+	data := make([]byte, 256<<10)
+	srv.SetBundle("config", data)
+
+	api := newTestAPI(t, srv)
+
+	// the token and the download URL are cached, so the only timers are the throttling ones
+	_, err := api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	var buf bytes.Buffer
+	go func() {
+		_, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil,
+			zerosdk.WithDownloadBandwidthLimit(64<<10),
+		)
+		done <- err
+	}()
+
+	start := clk.Now()
+	for {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			assert.Equal(t, data, buf.Bytes())
+			// the first second worth of bytes is the burst
+			assert.Equal(t, time.Second*3, clk.Since(start))
+			return
+		default:
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+		if clk.BlockUntil(waitCtx, 1) == nil {
+			clk.Advance(time.Millisecond * 250)
+		}
+		cancel()
+	}
+}
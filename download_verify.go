@@ -0,0 +1,194 @@
+package zerosdk
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // used by the storage providers for the content checksums
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pomerium/zero-sdk/apierror"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+)
+
+// ErrChecksumMismatch is returned when the downloaded bundle does not match the checksum advertised by the cloud
+var ErrChecksumMismatch = errors.New("bundle checksum mismatch")
+
+// digestAlgorithm is the algorithm of DownloadResult.Digest
+const digestAlgorithm = "sha256"
+
+// bundleVerifier computes the digest of the downloaded bundle content,
+// and verifies it against the checksum returned along with the download URL,
+// and the body as served against the checksums the storage advertised in the response headers.
+type bundleVerifier struct {
+	content hash.Hash
+	// expected is the hex encoded content digest, empty if the cloud did not advertise one
+	expected string
+
+	raw    []rawChecksum
+	rawEOF bool
+}
+
+// rawChecksum is a checksum of the body as served, i.e. compressed
+type rawChecksum struct {
+	name string
+	hash hash.Hash
+	want []byte
+}
+
+func newBundleVerifier(logger zerolog.Logger, checksum string, resp *http.Response) *bundleVerifier {
+	v := &bundleVerifier{
+		content: sha256.New(),
+		raw:     rawChecksums(logger, resp.Header),
+	}
+	if checksum == "" {
+		return v
+	}
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok || algorithm != digestAlgorithm {
+		logger.Warn().Str("checksum", checksum).Msg("unsupported bundle checksum, skipping verification")
+		return v
+	}
+	v.expected = strings.ToLower(digest)
+	return v
+}
+
+// rawChecksums returns the checksums advertised by the storage providers in the response headers
+func rawChecksums(logger zerolog.Logger, header http.Header) []rawChecksum {
+	// with the decompressive transcoding, the stored object checksums do not match the body as served
+	if stored := header.Get("X-Goog-Stored-Content-Encoding"); stored != "" && stored != header.Get("Content-Encoding") {
+		return nil
+	}
+
+	var checksums []rawChecksum
+	add := func(name, value string, h hash.Hash) {
+		want, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil || len(want) != h.Size() {
+			logger.Warn().Str(name, value).Msg("invalid checksum header, skipping verification")
+			return
+		}
+		checksums = append(checksums, rawChecksum{name: name, hash: h, want: want})
+	}
+
+	if value := header.Get("Content-MD5"); value != "" {
+		add("md5", value, md5.New()) //nolint:gosec
+	}
+	// x-goog-hash: crc32c=n03x6A==, md5=Ojk9c3dhfxgoKVVHYwFbHQ==
+	for _, values := range header.Values("X-Goog-Hash") {
+		for _, kv := range strings.Split(values, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+			switch name {
+			case "crc32c":
+				add(name, value, crc32.New(crc32.MakeTable(crc32.Castagnoli)))
+			case "md5":
+				if header.Get("Content-MD5") == "" {
+					add(name, value, md5.New()) //nolint:gosec
+				}
+			}
+		}
+	}
+	return checksums
+}
+
+// rawReader returns the reader that computes the checksums of the body as served
+func (v *bundleVerifier) rawReader(r io.Reader) io.Reader {
+	return &rawChecksumReader{r: r, v: v}
+}
+
+// contentWriter returns the writer that computes the digest of the uncompressed bundle
+func (v *bundleVerifier) contentWriter() io.Writer {
+	return v.content
+}
+
+// Digest returns the content digest in the algorithm:hex form
+func (v *bundleVerifier) Digest() string {
+	return digestAlgorithm + ":" + hex.EncodeToString(v.content.Sum(nil))
+}
+
+// ExpectsContent reports whether the content is verified against the checksum advertised by the cloud,
+// that is not the case if there was none or its algorithm is not supported.
+func (v *bundleVerifier) ExpectsContent() bool {
+	return v.expected != ""
+}
+
+// ContentMatches reports whether the content digest matches the checksum, that is in the algorithm:hex form.
+func (v *bundleVerifier) ContentMatches(checksum string) bool {
+	return strings.EqualFold(checksum, v.Digest())
+}
+
+// Verify checks the computed digests against the advertised ones.
+// The error is terminal, as downloading the same bundle again would not help.
+func (v *bundleVerifier) Verify() error {
+	if v.expected != "" {
+		if got := hex.EncodeToString(v.content.Sum(nil)); got != v.expected {
+			return newChecksumError(fmt.Errorf("%w: %s expected %s, got %s", ErrChecksumMismatch, digestAlgorithm, v.expected, got))
+		}
+	}
+	return v.verifyRaw()
+}
+
+// SkipContent skips the content verification, i.e. after it was verified against the refreshed checksum
+func (v *bundleVerifier) SkipContent() {
+	v.expected = ""
+}
+
+func (v *bundleVerifier) verifyRaw() error {
+	// the body may not have been read to the end if the uncompressed size limit was reached
+	if !v.rawEOF {
+		return nil
+	}
+	for _, c := range v.raw {
+		if got := c.hash.Sum(nil); !bytes.Equal(got, c.want) {
+			return newChecksumError(fmt.Errorf("%w: %s expected %s, got %s", ErrChecksumMismatch, c.name,
+				base64.StdEncoding.EncodeToString(c.want), base64.StdEncoding.EncodeToString(got)))
+		}
+	}
+	return nil
+}
+
+// rejectedBundleError is the verification error, that carries the conditional of the rejected bundle,
+// so that the callers may skip it until it is updated
+type rejectedBundleError struct {
+	conditional *DownloadConditional
+	err         error
+}
+
+// Error implements error
+func (e *rejectedBundleError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap implements errors.Unwrap
+func (e *rejectedBundleError) Unwrap() error {
+	return e.err
+}
+
+func newChecksumError(err error) error {
+	return NewApplyError(cluster_api.InvalidBundle, apierror.NewTerminalError(err))
+}
+
+type rawChecksumReader struct {
+	r io.Reader
+	v *bundleVerifier
+}
+
+// Read implements io.Reader
+func (r *rawChecksumReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for _, c := range r.v.raw {
+		_, _ = c.hash.Write(p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		r.v.rawEOF = true
+	}
+	return n, err
+}
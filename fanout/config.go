@@ -1,6 +1,12 @@
 package fanout
 
-import "time"
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pomerium/zero-sdk/clock"
+)
 
 const (
 	defaultPublishTimeout = time.Second
@@ -24,6 +30,10 @@ type config struct {
 	publishBufferSize       int
 	subscriberBufferSize    int
 	addSubscriberTimeout    time.Duration
+	onSubscriberCount       func(n int)
+	onSubscriberEvicted     func()
+	logger                  zerolog.Logger
+	clock                   clock.Clock
 }
 
 // Option configures a FanOut
@@ -96,6 +106,36 @@ func WithAddSubscriberTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithOnSubscriberCount sets the callback that is called with the current number of subscribers
+// whenever it changes. It is called from the dispatch loop and should not block.
+func WithOnSubscriberCount(onCount func(n int)) Option {
+	return func(c *config) {
+		c.onSubscriberCount = onCount
+	}
+}
+
+// WithOnSubscriberEvicted sets the callback that is called whenever a subscriber is evicted
+// as it cannot keep up consuming messages. It is called from the dispatch loop and should not block.
+func WithOnSubscriberEvicted(onEvicted func()) Option {
+	return func(c *config) {
+		c.onSubscriberEvicted = onEvicted
+	}
+}
+
+// WithLogger sets the logger, by default nothing is logged
+func WithLogger(logger zerolog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithClock sets the clock the publish, add subscriber and receiver callback timeouts are measured with
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
 func defaultFanOutConfig() config {
 	var c config
 	c.apply(
@@ -105,6 +145,10 @@ func defaultFanOutConfig() config {
 		WithReceiverBufferSize(defaultReceiverBufferSize),
 		WithSubscriberBufferSize(defaultSubscriberBufferSize),
 		WithAddSubscriberTimeout(defaultAddSubscriberTimeout),
+		WithOnSubscriberCount(func(int) {}),
+		WithOnSubscriberEvicted(func() {}),
+		WithLogger(zerolog.Nop()),
+		WithClock(clock.Real()),
 	)
 	return c
 }
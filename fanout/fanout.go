@@ -3,6 +3,8 @@ package fanout
 import (
 	"context"
 	"errors"
+
+	"github.com/pomerium/zero-sdk/clock"
 )
 
 var (
@@ -19,7 +21,14 @@ type FanOut[T any] struct {
 	cfg         config
 	done        <-chan struct{}
 	messages    chan T
-	subscribers chan *subscriber[T]
+	subscribers chan subscriberUpdate[T]
+}
+
+// subscriberUpdate adds the subscriber to the fanout, or removes it once its Receive returns.
+// Both go through the same channel, so the removal is never handled before the addition.
+type subscriberUpdate[T any] struct {
+	sub    *subscriber[T]
+	remove bool
 }
 
 // Start creates and runs a new FanOut
@@ -31,7 +40,7 @@ func Start[T any](ctx context.Context, opts ...Option) *FanOut[T] {
 		cfg:         cfg,
 		done:        ctx.Done(),
 		messages:    make(chan T, cfg.publishBufferSize),
-		subscribers: make(chan *subscriber[T], cfg.subscriberBufferSize),
+		subscribers: make(chan subscriberUpdate[T], cfg.subscriberBufferSize),
 	}
 	go f.dispatchLoop(ctx)
 	return f
@@ -39,23 +48,44 @@ func Start[T any](ctx context.Context, opts ...Option) *FanOut[T] {
 
 func (f *FanOut[T]) dispatchLoop(ctx context.Context) {
 	subscribers := make(subscribers[T])
-	defer subscribers.closeAll(ErrStopped)
+	defer func() {
+		subscribers.closeAll(ErrStopped)
+		f.cfg.onSubscriberCount(0)
+	}()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case sub := <-f.subscribers:
-			subscribers.add(sub)
+		case upd := <-f.subscribers:
+			if !upd.remove {
+				subscribers.add(upd.sub)
+			} else if close, ok := subscribers[upd.sub]; ok {
+				close(ErrSubscriberClosed)
+			} else {
+				// the subscriber was already evicted
+				continue
+			}
+			f.cfg.onSubscriberCount(len(subscribers))
 			continue
 		case msg := <-f.messages:
-			subscribers.dispatch(ctx, msg)
+			n := len(subscribers)
+			evicted := subscribers.dispatch(ctx, msg)
+			if evicted > 0 {
+				f.cfg.logger.Warn().Int("evicted", evicted).Msg("evicted subscribers that could not keep up")
+			}
+			for i := 0; i < evicted; i++ {
+				f.cfg.onSubscriberEvicted()
+			}
+			if len(subscribers) != n {
+				f.cfg.onSubscriberCount(len(subscribers))
+			}
 		}
 	}
 }
 
 func (f *FanOut[T]) addSubscriber(ctx context.Context, sub *subscriber[T]) error {
-	ctx, cancel := context.WithTimeout(ctx, f.cfg.addSubscriberTimeout)
+	ctx, cancel := clock.WithTimeout(ctx, f.cfg.clock, f.cfg.addSubscriberTimeout)
 	defer cancel()
 
 	select {
@@ -63,7 +93,15 @@ func (f *FanOut[T]) addSubscriber(ctx context.Context, sub *subscriber[T]) error
 		return context.Cause(ctx)
 	case <-f.done:
 		return ErrStopped
-	case f.subscribers <- sub:
+	case f.subscribers <- subscriberUpdate[T]{sub: sub}:
 		return nil
 	}
 }
+
+// removeSubscriber removes the subscriber which Receive returned, unless the fanout is stopped
+func (f *FanOut[T]) removeSubscriber(sub *subscriber[T]) {
+	select {
+	case <-f.done:
+	case f.subscribers <- subscriberUpdate[T]{sub: sub, remove: true}:
+	}
+}
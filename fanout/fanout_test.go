@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -38,9 +39,12 @@ func TestFanOutEvictSlowSubscriber(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	t.Cleanup(cancel)
 
+	var evicted, subscribers atomic.Int32
 	f := fanout.Start[int](ctx,
 		fanout.WithReceiverBufferSize(1),
 		fanout.WithReceiverCallbackTimeout(timeout),
+		fanout.WithOnSubscriberEvicted(func() { evicted.Add(1) }),
+		fanout.WithOnSubscriberCount(func(n int) { subscribers.Store(int32(n)) }),
 	)
 
 	subscriberAdded := make(chan struct{})
@@ -77,6 +81,10 @@ func TestFanOutEvictSlowSubscriber(t *testing.T) {
 		return nil
 	})
 	require.NoError(t, eg.Wait())
+
+	assert.Eventually(t, func() bool {
+		return evicted.Load() == 1 && subscribers.Load() == 0
+	}, timeout, 10*time.Millisecond, "eviction should be reported")
 }
 
 func TestFanOutReceiverCancelOnError(t *testing.T) {
@@ -180,3 +188,29 @@ func BenchmarkFanout(b *testing.B) {
 	})
 	require.NoError(b, eg.Wait())
 }
+
+func TestFanOutSubscriberRemoved(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	t.Cleanup(cancel)
+
+	var subscribers atomic.Int32
+	f := fanout.Start[int](ctx, fanout.WithOnSubscriberCount(func(n int) { subscribers.Store(int32(n)) }))
+
+	receiveCtx, stop := context.WithCancel(ctx)
+	added := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- f.Receive(receiveCtx, func(_ context.Context, _ int) error { return nil },
+			fanout.WithOnSubscriberAdded[int](func() { close(added) }))
+	}()
+
+	<-added
+	assert.Eventually(t, func() bool { return subscribers.Load() == 1 }, time.Second, time.Millisecond*10)
+
+	// no message is published, so the subscriber is only removed once its Receive returns
+	stop()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+	assert.Eventually(t, func() bool { return subscribers.Load() == 0 }, time.Second, time.Millisecond*10)
+}
@@ -1,16 +1,20 @@
 package fanout
 
-import "context"
+import (
+	"context"
+
+	"github.com/pomerium/zero-sdk/clock"
+)
 
 // Publish publishes a message to all currently registered subscribers
 // if the fanout is closed, ErrStopped is returned
 func (f *FanOut[T]) Publish(ctx context.Context, msg T) error {
-	ctx, cancel := context.WithTimeout(ctx, f.cfg.publishTimeout)
+	ctx, cancel := clock.WithTimeout(ctx, f.cfg.clock, f.cfg.publishTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return context.Cause(ctx)
 	case <-f.done:
 		return ErrStopped
 	case f.messages <- msg:
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/pomerium/zero-sdk/clock"
 )
 
 // ReceiverCallback is the callback function that is called for each message received
@@ -43,6 +45,7 @@ func (f *FanOut[T]) Receive(ctx context.Context, onMessage ReceiverCallback[T],
 	if err != nil {
 		return fmt.Errorf("add subscriber: %w", err)
 	}
+	defer f.removeSubscriber(sub)
 
 	err = f.receiveLoop(ctx, messages, onMessage)
 	if err != nil {
@@ -84,7 +87,7 @@ func (f *FanOut[T]) receiveLoop(
 			if !ok {
 				return ErrSubscriberEvicted
 			}
-			err := callWithTimeout(ctx, f.cfg.receiverCallbackTimeout, onMessage, msg)
+			err := callWithTimeout(ctx, f.cfg.clock, f.cfg.receiverCallbackTimeout, onMessage, msg)
 			if err != nil {
 				return fmt.Errorf("onMessage callback: %w", err)
 			}
@@ -94,11 +97,12 @@ func (f *FanOut[T]) receiveLoop(
 
 func callWithTimeout[T any](
 	ctx context.Context,
+	clk clock.Clock,
 	timeout time.Duration,
 	cb ReceiverCallback[T],
 	msg T,
 ) error {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, cancel := clock.WithTimeout(ctx, clk, timeout)
 	defer cancel()
 
 	return cb(ctx, msg)
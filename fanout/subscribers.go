@@ -45,8 +45,9 @@ func (s subscribers[T]) add(sub *subscriber[T]) {
 	}
 }
 
-// dispatch dispatches the given message to all subscribers
-func (s subscribers[T]) dispatch(ctx context.Context, msg T) {
+// dispatch dispatches the given message to all subscribers,
+// and returns the number of subscribers evicted as they could not keep up
+func (s subscribers[T]) dispatch(ctx context.Context, msg T) (evicted int) {
 	for sub, close := range s {
 		if sub.filter != nil && !sub.filter(msg) {
 			continue
@@ -54,12 +55,14 @@ func (s subscribers[T]) dispatch(ctx context.Context, msg T) {
 
 		select {
 		case <-ctx.Done():
-			return
+			return evicted
 		case sub.messages <- msg:
 		case <-sub.done:
 			close(ErrSubscriberClosed)
 		default:
 			close(ErrSubscriberEvicted)
+			evicted++
 		}
 	}
+	return evicted
 }
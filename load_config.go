@@ -0,0 +1,228 @@
+package zerosdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v3"
+)
+
+// The environment variables read by LoadConfig and NewAPIFromEnv
+const (
+	EnvConfigFile           = "POMERIUM_ZERO_CONFIG_FILE"
+	EnvClusterAPIEndpoint   = "POMERIUM_ZERO_CLUSTER_API_ENDPOINT"
+	EnvConnectAPIEndpoint   = "POMERIUM_ZERO_CONNECT_API_ENDPOINT"
+	EnvAPIToken             = "POMERIUM_ZERO_API_TOKEN"
+	EnvAPITokenFile         = "POMERIUM_ZERO_API_TOKEN_FILE"
+	EnvDownloadURLCacheTTL  = "POMERIUM_ZERO_DOWNLOAD_URL_CACHE_TTL"
+	EnvBootstrapConfigCache = "POMERIUM_ZERO_BOOTSTRAP_CONFIG_CACHE"
+	EnvTLSCAFile            = "POMERIUM_ZERO_TLS_CA_FILE"
+	EnvTLSCertFile          = "POMERIUM_ZERO_TLS_CERT_FILE"
+	EnvTLSKeyFile           = "POMERIUM_ZERO_TLS_KEY_FILE"
+)
+
+// fileConfig is the configuration read from the config file and the environment
+type fileConfig struct {
+	ClusterAPIEndpoint   string        `yaml:"clusterApiEndpoint"`
+	ConnectAPIEndpoint   string        `yaml:"connectApiEndpoint"`
+	APIToken             string        `yaml:"apiToken"`
+	APITokenFile         string        `yaml:"apiTokenFile"`
+	DownloadURLCacheTTL  time.Duration `yaml:"downloadUrlCacheTtl"`
+	BootstrapConfigCache string        `yaml:"bootstrapConfigCache"`
+	TLS                  struct {
+		CAFile   string `yaml:"caFile"`
+		CertFile string `yaml:"certFile"`
+		KeyFile  string `yaml:"keyFile"`
+	} `yaml:"tls"`
+}
+
+// NewAPIFromEnv creates a new API client with the options loaded by LoadConfig
+// from the config file set by POMERIUM_ZERO_CONFIG_FILE environment variable, if any,
+// and the other POMERIUM_ZERO_* environment variables. The given options are applied last.
+func NewAPIFromEnv(ctx context.Context, opts ...Option) (*API, error) {
+	loaded, err := loadConfig(os.Getenv(EnvConfigFile))
+	if err != nil {
+		// the settings that are missing or invalid are reported along with the config errors
+		errs := multierror.Append(nil, err)
+		if err := newDefaultConfig(append(loaded, opts...)...).validate(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		return nil, fmt.Errorf("load config: %w", errs)
+	}
+	return NewAPI(ctx, append(loaded, opts...)...)
+}
+
+// LoadConfig builds the options from the YAML or JSON config file, if the path is not empty,
+// and the POMERIUM_ZERO_* environment variables, that take precedence over the file.
+// The empty environment variables are ignored, and the API token set in the environment
+// replaces both apiToken and apiTokenFile of the file. All the invalid settings are reported at once.
+//
+// The config file may contain clusterApiEndpoint, connectApiEndpoint, apiToken or apiTokenFile,
+// downloadUrlCacheTtl (i.e. 15m), bootstrapConfigCache (path to the cache file)
+// and tls section with caFile, certFile and keyFile PEM files.
+func LoadConfig(path string) ([]Option, error) {
+	opts, err := loadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	return opts, nil
+}
+
+// loadConfig returns the options built from the valid settings along with the errors of the invalid ones
+func loadConfig(path string) ([]Option, error) {
+	var errs *multierror.Error
+
+	fc := new(fileConfig)
+	if path != "" {
+		if err := fc.readFile(path); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	if err := fc.readEnv(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	opts, err := fc.options()
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	return opts, errs.ErrorOrNil()
+}
+
+func (fc *fileConfig) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	// JSON is a subset of YAML, so both are parsed the same way
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(fc); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// readEnv overrides the settings with the environment variables that are set and not empty
+func (fc *fileConfig) readEnv() error {
+	var errs *multierror.Error
+
+	// the API token set in the environment replaces the one from the file, however either is set
+	if os.Getenv(EnvAPIToken) != "" || os.Getenv(EnvAPITokenFile) != "" {
+		fc.APIToken, fc.APITokenFile = "", ""
+	}
+	for env, dst := range map[string]*string{
+		EnvClusterAPIEndpoint:   &fc.ClusterAPIEndpoint,
+		EnvConnectAPIEndpoint:   &fc.ConnectAPIEndpoint,
+		EnvAPIToken:             &fc.APIToken,
+		EnvAPITokenFile:         &fc.APITokenFile,
+		EnvBootstrapConfigCache: &fc.BootstrapConfigCache,
+		EnvTLSCAFile:            &fc.TLS.CAFile,
+		EnvTLSCertFile:          &fc.TLS.CertFile,
+		EnvTLSKeyFile:           &fc.TLS.KeyFile,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*dst = v
+		}
+	}
+
+	if v := os.Getenv(EnvDownloadURLCacheTTL); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %w", EnvDownloadURLCacheTTL, err))
+		}
+		fc.DownloadURLCacheTTL = ttl
+	}
+	return errs.ErrorOrNil()
+}
+
+func (fc *fileConfig) options() ([]Option, error) {
+	var errs *multierror.Error
+	var opts []Option
+
+	if fc.ClusterAPIEndpoint != "" {
+		opts = append(opts, WithClusterAPIEndpoint(fc.ClusterAPIEndpoint))
+	}
+	if fc.ConnectAPIEndpoint != "" {
+		opts = append(opts, WithConnectAPIEndpoint(fc.ConnectAPIEndpoint))
+	}
+
+	switch {
+	case fc.APIToken != "" && fc.APITokenFile != "":
+		errs = multierror.Append(errs, fmt.Errorf("only one of API token and API token file may be set"))
+	case fc.APITokenFile != "":
+		data, err := os.ReadFile(fc.APITokenFile)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("read API token file: %w", err))
+		}
+		opts = append(opts, WithAPIToken(strings.TrimSpace(string(data))))
+	case fc.APIToken != "":
+		opts = append(opts, WithAPIToken(fc.APIToken))
+	}
+
+	if fc.DownloadURLCacheTTL != 0 {
+		opts = append(opts, WithDownloadURLCacheTTL(fc.DownloadURLCacheTTL))
+	}
+	if fc.BootstrapConfigCache != "" {
+		opts = append(opts, WithBootstrapConfigCache(fc.BootstrapConfigCache, nil))
+	}
+
+	tlsConfig, err := fc.tlsConfig()
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	} else if tlsConfig != nil {
+		opts = append(opts, WithTLSConfig(tlsConfig))
+	}
+
+	return opts, errs.ErrorOrNil()
+}
+
+// tlsConfig returns the TLS config trusting the CA bundle in addition to the system roots,
+// and presenting the client certificate; nil if neither is set
+func (fc *fileConfig) tlsConfig() (*tls.Config, error) {
+	if fc.TLS.CAFile == "" && fc.TLS.CertFile == "" && fc.TLS.KeyFile == "" {
+		return nil, nil
+	}
+
+	var errs *multierror.Error
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if fc.TLS.CAFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(fc.TLS.CAFile)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("read TLS CA file: %w", err))
+		} else if !roots.AppendCertsFromPEM(pem) {
+			errs = multierror.Append(errs, fmt.Errorf("TLS CA file %s contains no certificates", fc.TLS.CAFile))
+		}
+		cfg.RootCAs = roots
+	}
+
+	if fc.TLS.CertFile != "" || fc.TLS.KeyFile != "" {
+		if fc.TLS.CertFile == "" || fc.TLS.KeyFile == "" {
+			errs = multierror.Append(errs, fmt.Errorf("both TLS certificate and key files must be set"))
+		} else {
+			cert, err := tls.LoadX509KeyPair(fc.TLS.CertFile, fc.TLS.KeyFile)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("load TLS client certificate: %w", err))
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,166 @@
+package zerosdk_test
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	srv := zerotest.NewServer(t, zerotest.WithTLS())
+	ca := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	})))
+	tokenFile := writeFile(t, "token", srv.APIToken()+"\n")
+
+	t.Run("yaml file", func(t *testing.T) {
+		ctx := testContext(t)
+		path := writeFile(t, "config.yaml", `
+clusterApiEndpoint: `+srv.ClusterAPIEndpoint()+`
+connectApiEndpoint: `+srv.ConnectAPIEndpoint()+`
+apiTokenFile: `+tokenFile+`
+downloadUrlCacheTtl: 5m
+tls:
+  caFile: `+ca+`
+`)
+		opts, err := zerosdk.LoadConfig(path)
+		require.NoError(t, err)
+
+		api, err := zerosdk.NewAPI(ctx, opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = api.Close() })
+
+		_, err = api.GetClusterBootstrapConfig(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("json file and environment", func(t *testing.T) {
+		ctx := testContext(t)
+		path := writeFile(t, "config.json", `{
+			"clusterApiEndpoint": "http://invalid.example.com",
+			"connectApiEndpoint": "`+srv.ConnectAPIEndpoint()+`",
+			"apiToken": "`+srv.APIToken()+`"
+		}`)
+		t.Setenv(zerosdk.EnvConfigFile, path)
+		t.Setenv(zerosdk.EnvClusterAPIEndpoint, srv.ClusterAPIEndpoint())
+		t.Setenv(zerosdk.EnvTLSCAFile, ca)
+
+		api, err := zerosdk.NewAPIFromEnv(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = api.Close() })
+
+		_, err = api.GetClusterBootstrapConfig(ctx)
+		assert.NoError(t, err, "environment should take precedence over the file")
+	})
+
+	t.Run("token from environment", func(t *testing.T) {
+		ctx := testContext(t)
+		endpoints := `
+clusterApiEndpoint: ` + srv.ClusterAPIEndpoint() + `
+connectApiEndpoint: ` + srv.ConnectAPIEndpoint() + `
+tls:
+  caFile: ` + ca + `
+`
+		for _, tc := range []struct {
+			name, file, env, value string
+		}{
+			{"token over token file", "apiTokenFile: " + filepath.Join(t.TempDir(), "missing"), zerosdk.EnvAPIToken, srv.APIToken()},
+			{"token file over token", "apiToken: invalid", zerosdk.EnvAPITokenFile, tokenFile},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Setenv(tc.env, tc.value)
+				opts, err := zerosdk.LoadConfig(writeFile(t, "config.yaml", endpoints+tc.file))
+				require.NoError(t, err)
+
+				api, err := zerosdk.NewAPI(ctx, opts...)
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = api.Close() })
+
+				_, err = api.GetClusterBootstrapConfig(ctx)
+				assert.NoError(t, err)
+			})
+		}
+	})
+
+	t.Run("empty environment variables are ignored", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", `
+clusterApiEndpoint: `+srv.ClusterAPIEndpoint()+`
+connectApiEndpoint: `+srv.ConnectAPIEndpoint()+`
+apiToken: `+srv.APIToken()+`
+downloadUrlCacheTtl: 5m
+`)
+		t.Setenv(zerosdk.EnvClusterAPIEndpoint, "")
+		t.Setenv(zerosdk.EnvAPIToken, "")
+		t.Setenv(zerosdk.EnvDownloadURLCacheTTL, "")
+
+		opts, err := zerosdk.LoadConfig(path)
+		require.NoError(t, err)
+		_, err = zerosdk.NewAPI(testContext(t), opts...)
+		assert.NoError(t, err)
+	})
+
+	t.Run("config and validation errors are aggregated", func(t *testing.T) {
+		t.Setenv(zerosdk.EnvConfigFile, writeFile(t, "config.yaml", `
+apiToken: token
+tls:
+  certFile: cert.pem
+`))
+
+		_, err := zerosdk.NewAPIFromEnv(testContext(t))
+		var merr *multierror.Error
+		require.ErrorAs(t, err, &merr)
+		assert.Len(t, merr.Errors, 3, err.Error())
+		assert.ErrorContains(t, err, "both TLS certificate and key files must be set")
+		assert.ErrorContains(t, err, "cluster API endpoint is required")
+	})
+
+	t.Run("errors are aggregated", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", `
+apiToken: token
+apiTokenFile: `+tokenFile+`
+tls:
+  certFile: cert.pem
+`)
+		t.Setenv(zerosdk.EnvDownloadURLCacheTTL, "five minutes")
+
+		_, err := zerosdk.LoadConfig(path)
+		var merr *multierror.Error
+		require.ErrorAs(t, err, &merr)
+		assert.Len(t, merr.Errors, 3, err.Error())
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", "clusterEndpoint: http://localhost\n")
+		_, err := zerosdk.LoadConfig(path)
+		assert.ErrorContains(t, err, "clusterEndpoint")
+	})
+}
+
+func TestConfigValidation(t *testing.T) {
+	t.Parallel()
+
+	_, err := zerosdk.NewAPI(testContext(t),
+		zerosdk.WithClusterAPIEndpoint("localhost:8080"),
+		zerosdk.WithDownloadURLCacheTTL(-1),
+	)
+	var merr *multierror.Error
+	require.ErrorAs(t, err, &merr)
+	assert.Len(t, merr.Errors, 4, err.Error())
+}
@@ -0,0 +1,319 @@
+package zerosdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+
+	connect_api "github.com/pomerium/zero-sdk/connect"
+	connect_mux "github.com/pomerium/zero-sdk/connect-mux"
+	"github.com/pomerium/zero-sdk/fanout"
+)
+
+var (
+	// ErrManagerClosed is returned when the Manager is used after it was closed
+	ErrManagerClosed = errors.New("manager is closed")
+	// ErrClusterExists is returned when adding a cluster with the key that is already in use
+	ErrClusterExists = errors.New("cluster already exists")
+	// ErrClusterNotFound is returned when the cluster with the given key is not managed
+	ErrClusterNotFound = errors.New("cluster not found")
+)
+
+// watchRestartDelay is how long to wait before watching the cluster again, i.e. after the watcher was evicted
+const watchRestartDelay = time.Second
+
+// ClusterEventType is the type of the ClusterEvent
+type ClusterEventType string
+
+const (
+	// ClusterAdded is sent once the cluster is added to the Manager
+	ClusterAdded ClusterEventType = "added"
+	// ClusterRemoved is sent once the cluster is removed from the Manager
+	ClusterRemoved ClusterEventType = "removed"
+	// ClusterConnected is sent when the cluster is connected to the connect API
+	ClusterConnected ClusterEventType = "connected"
+	// ClusterDisconnected is sent when the cluster is disconnected from the connect API
+	ClusterDisconnected ClusterEventType = "disconnected"
+	// ClusterBundleUpdated is sent when the cluster resource bundle is updated
+	ClusterBundleUpdated ClusterEventType = "bundle_updated"
+	// ClusterBootstrapConfigUpdated is sent when the cluster bootstrap config is updated
+	ClusterBootstrapConfigUpdated ClusterEventType = "bootstrap_config_updated"
+)
+
+// ClusterEvent is the event of one of the clusters managed by the Manager
+type ClusterEvent struct {
+	// Cluster is the key the cluster was added with
+	Cluster string
+	Type    ClusterEventType
+	// BundleID is set for ClusterBundleUpdated events
+	BundleID string
+}
+
+// Manager holds the API clients of multiple clusters, keyed by the caller provided cluster key.
+// The clusters share the HTTP transport, and the connect API connections of the clusters with the same endpoint.
+// Each cluster is connected to the connect API once added,
+// and its events are delivered to the Manager watchers tagged with the cluster key.
+type Manager struct {
+	opts   []Option
+	shared *sharedTransport
+	logger zerolog.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	events *fanout.FanOut[ClusterEvent]
+
+	mx       sync.Mutex
+	clusters map[string]*managedCluster
+	closed   bool
+}
+
+type managedCluster struct {
+	api    *API
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// sharedTransport is the HTTP client and connect API connection pool shared by the Manager clusters,
+// the pool is nil if the cluster has its own connect API connection
+type sharedTransport struct {
+	httpClient  *http.Client
+	connectPool *connect_api.Pool
+}
+
+func withSharedTransport(shared *sharedTransport) Option {
+	return func(cfg *config) {
+		cfg.shared = shared
+	}
+}
+
+// withClusterLogger tags the cluster logs with its key, it has to be applied last
+func withClusterLogger(key string) Option {
+	return func(cfg *config) {
+		cfg.logger = cfg.logger.With().Str("cluster", key).Logger()
+	}
+}
+
+// withClusterMetrics tags the metrics of the cluster with its key
+func withClusterMetrics(key string) Option {
+	return func(cfg *config) {
+		cfg.metricAttributes = []attribute.KeyValue{attribute.String("zero.cluster", key)}
+	}
+}
+
+// NewManager creates a new Manager. The options are applied to every cluster before the cluster own options.
+// The transport options (WithHTTPClient, WithTLSConfig, WithProxy) should be set on the Manager, so that they are shared;
+// if they are set for a cluster, that cluster uses its own HTTP transport and connect API connection.
+// Likewise, a cluster with its own WithPropagator uses its own connect API connection.
+func NewManager(opts ...Option) (*Manager, error) {
+	cfg := newDefaultConfig(opts...)
+	if err := cfg.applyTransportOptions(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		opts: opts,
+		shared: &sharedTransport{
+			httpClient:  cfg.httpClient,
+			connectPool: connect_api.NewPool(connectOptions(cfg)...),
+		},
+		logger:   cfg.logger,
+		ctx:      ctx,
+		cancel:   cancel,
+		events:   fanout.Start[ClusterEvent](ctx),
+		clusters: make(map[string]*managedCluster),
+	}, nil
+}
+
+// Add creates the API client of the cluster with the Manager and the given options,
+// and connects it to the connect API until the cluster is removed or the Manager is closed.
+func (m *Manager) Add(ctx context.Context, key string, opts ...Option) error {
+	if err := m.add(ctx, key, opts...); err != nil {
+		return err
+	}
+	m.publish(ClusterEvent{Cluster: key, Type: ClusterAdded})
+	return nil
+}
+
+func (m *Manager) add(ctx context.Context, key string, opts ...Option) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if m.closed {
+		return ErrManagerClosed
+	}
+	if _, ok := m.clusters[key]; ok {
+		return fmt.Errorf("%s: %w", key, ErrClusterExists)
+	}
+
+	clusterOpts := append(append(append([]Option{}, m.opts...), withSharedTransport(m.shared)), opts...)
+	clusterOpts = append(clusterOpts, withClusterLogger(key), withClusterMetrics(key))
+	api, err := NewAPI(ctx, clusterOpts...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	runCtx, cancel := context.WithCancel(m.ctx)
+	c := &managedCluster{
+		api:    api,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.clusters[key] = c
+
+	go func() {
+		defer close(c.done)
+		m.run(runCtx, key, api)
+	}()
+	return nil
+}
+
+// Remove disconnects and closes the API client of the cluster, and removes it from the Manager
+func (m *Manager) Remove(key string) error {
+	m.mx.Lock()
+	c, ok := m.clusters[key]
+	delete(m.clusters, key)
+	m.mx.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%s: %w", key, ErrClusterNotFound)
+	}
+
+	err := c.close()
+	m.publish(ClusterEvent{Cluster: key, Type: ClusterRemoved})
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// Get returns the API client of the cluster
+func (m *Manager) Get(key string) (*API, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	c, ok := m.clusters[key]
+	if !ok {
+		return nil, false
+	}
+	return c.api, true
+}
+
+// Keys returns the sorted keys of the managed clusters
+func (m *Manager) Keys() []string {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	keys := make([]string, 0, len(m.clusters))
+	for key := range m.clusters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Watch calls onEvent for the events of all the managed clusters,
+// until the context is canceled or the Manager is closed, in which case fanout.ErrStopped is returned.
+// The events of the clusters added later are delivered too.
+func (m *Manager) Watch(ctx context.Context, onEvent func(context.Context, ClusterEvent)) error {
+	return m.events.Receive(ctx, func(ctx context.Context, evt ClusterEvent) error {
+		onEvent(ctx, evt)
+		return nil
+	})
+}
+
+// Close removes all the clusters, closing their API clients, and stops the watchers.
+// The Manager may not be used once it is closed.
+func (m *Manager) Close() error {
+	m.mx.Lock()
+	if m.closed {
+		m.mx.Unlock()
+		return nil
+	}
+	m.closed = true
+	clusters := m.clusters
+	m.clusters = make(map[string]*managedCluster)
+	m.mx.Unlock()
+
+	var errs *multierror.Error
+	for key, c := range clusters {
+		if err := c.close(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	m.cancel()
+	m.shared.httpClient.CloseIdleConnections()
+	return errs.ErrorOrNil()
+}
+
+func (c *managedCluster) close() error {
+	c.cancel()
+	err := c.api.Close()
+	<-c.done
+	return err
+}
+
+// run connects the cluster and routes its events to the Manager watchers
+func (m *Manager) run(ctx context.Context, key string, api *API) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err := api.Connect(ctx)
+		if ctx.Err() == nil && !errors.Is(err, ErrClosed) {
+			m.logger.Error().Err(err).Str("cluster", key).Msg("cluster connect API stopped")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		m.watch(ctx, key, api)
+	}()
+	wg.Wait()
+}
+
+func (m *Manager) watch(ctx context.Context, key string, api *API) {
+	publish := func(typ ClusterEventType) func(context.Context) {
+		return func(context.Context) {
+			m.publish(ClusterEvent{Cluster: key, Type: typ})
+		}
+	}
+
+	for {
+		err := api.Watch(ctx,
+			connect_mux.WithOnConnected(publish(ClusterConnected)),
+			connect_mux.WithOnDisconnected(publish(ClusterDisconnected)),
+			connect_mux.WithOnBootstrapConfigUpdated(publish(ClusterBootstrapConfigUpdated)),
+			connect_mux.WithOnBundleUpdated(func(_ context.Context, bundleID string) {
+				m.publish(ClusterEvent{Cluster: key, Type: ClusterBundleUpdated, BundleID: bundleID})
+			}),
+		)
+		if ctx.Err() != nil || api.isClosed() {
+			return
+		}
+		m.logger.Warn().Err(err).Str("cluster", key).Msg("cluster watch stopped, restarting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-api.cfg.clock.After(watchRestartDelay):
+		}
+	}
+}
+
+func (m *Manager) publish(evt ClusterEvent) {
+	err := m.events.Publish(m.ctx, evt)
+	if err != nil && m.ctx.Err() == nil {
+		m.logger.Error().Err(err).
+			Str("cluster", evt.Cluster).
+			Str("event", string(evt.Type)).
+			Msg("error publishing cluster event")
+	}
+}
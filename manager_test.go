@@ -0,0 +1,133 @@
+package zerosdk_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+// clusterOptions returns the server options, except for the HTTP client, that is shared by the Manager
+func clusterOptions(srv *zerotest.Server) []zerosdk.Option {
+	return []zerosdk.Option{
+		zerosdk.WithClusterAPIEndpoint(srv.ClusterAPIEndpoint()),
+		zerosdk.WithConnectAPIEndpoint(srv.ConnectAPIEndpoint()),
+		zerosdk.WithAPIToken(srv.APIToken()),
+	}
+}
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv1 := zerotest.NewServer(t)
+	srv2 := zerotest.NewServer(t)
+
+	m, err := zerosdk.NewManager()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+
+	events := make(chan zerosdk.ClusterEvent, 64)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- m.Watch(ctx, func(_ context.Context, evt zerosdk.ClusterEvent) { events <- evt })
+	}()
+
+	// the watcher may only subscribe after the clusters were added,
+	// so keep publishing until the first message of each cluster goes through
+	waitFor := func(publish func(), want zerosdk.ClusterEvent) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			publish()
+			for {
+				select {
+				case evt := <-events:
+					if evt == want {
+						return true
+					}
+				case <-time.After(time.Millisecond * 50):
+					return false
+				}
+			}
+		}, time.Second*5, time.Millisecond)
+	}
+
+	require.NoError(t, m.Add(ctx, "a", clusterOptions(srv1)...))
+	require.NoError(t, m.Add(ctx, "b", clusterOptions(srv2)...))
+	require.NoError(t, m.Add(ctx, "a2", clusterOptions(srv1)...), "clusters may share the endpoint")
+	assert.ErrorIs(t, m.Add(ctx, "a", clusterOptions(srv1)...), zerosdk.ErrClusterExists)
+	assert.Equal(t, []string{"a", "a2", "b"}, m.Keys())
+
+	require.NoError(t, srv1.WaitForStreams(ctx, 2))
+	require.NoError(t, srv2.WaitForStreams(ctx, 1))
+
+	waitFor(func() { srv2.PublishConfigUpdated(1) },
+		zerosdk.ClusterEvent{Cluster: "b", Type: zerosdk.ClusterBundleUpdated, BundleID: "config"})
+	waitFor(func() { srv1.PublishBootstrapConfigUpdated() },
+		zerosdk.ClusterEvent{Cluster: "a", Type: zerosdk.ClusterBootstrapConfigUpdated})
+	waitFor(func() { srv1.PublishBootstrapConfigUpdated() },
+		zerosdk.ClusterEvent{Cluster: "a2", Type: zerosdk.ClusterBootstrapConfigUpdated})
+
+	api, ok := m.Get("b")
+	require.True(t, ok)
+	_, err = api.GetClusterBootstrapConfig(ctx)
+	assert.NoError(t, err)
+
+	require.NoError(t, m.Remove("b"))
+	waitFor(func() {}, zerosdk.ClusterEvent{Cluster: "b", Type: zerosdk.ClusterRemoved})
+	assert.Eventually(t, func() bool { return srv2.StreamCount() == 0 },
+		time.Second*5, time.Millisecond*10, "stream should be closed")
+	assert.ErrorIs(t, m.Remove("b"), zerosdk.ErrClusterNotFound)
+	_, ok = m.Get("b")
+	assert.False(t, ok)
+
+	require.NoError(t, m.Add(ctx, "b", clusterOptions(srv2)...), "cluster may be added again")
+	require.NoError(t, srv2.WaitForStreams(ctx, 1))
+
+	require.NoError(t, m.Close())
+	assert.Error(t, <-watchErr, "watchers should be stopped")
+	assert.Eventually(t, func() bool { return srv1.StreamCount() == 0 && srv2.StreamCount() == 0 },
+		time.Second*5, time.Millisecond*10, "streams should be closed")
+	assert.ErrorIs(t, m.Add(ctx, "c", clusterOptions(srv1)...), zerosdk.ErrManagerClosed)
+	assert.Empty(t, m.Keys())
+}
+
+// streamPropagator counts the trace context injections into the connect stream metadata
+type streamPropagator struct {
+	propagation.TraceContext
+	injected atomic.Int32
+}
+
+func (p *streamPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if _, ok := carrier.(propagation.HeaderCarrier); !ok {
+		p.injected.Add(1)
+	}
+	p.TraceContext.Inject(ctx, carrier)
+}
+
+func TestManagerClusterPropagator(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	shared := new(streamPropagator)
+	m, err := zerosdk.NewManager(zerosdk.WithPropagator(shared))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+
+	own := new(streamPropagator)
+	require.NoError(t, m.Add(ctx, "a", clusterOptions(srv)...))
+	require.NoError(t, m.Add(ctx, "b", append(clusterOptions(srv), zerosdk.WithPropagator(own))...))
+	require.NoError(t, srv.WaitForStreams(ctx, 2))
+
+	assert.Positive(t, shared.injected.Load(), "the shared connection should use the Manager propagator")
+	assert.Positive(t, own.injected.Load(), "the cluster propagator should be used on its connect stream")
+}
@@ -0,0 +1,156 @@
+package zerosdk
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	token_api "github.com/pomerium/zero-sdk/token"
+)
+
+// bundle download results recorded by zero.bundle.downloads metric
+const (
+	downloadResultModified    = "modified"
+	downloadResultNotModified = "not_modified"
+	downloadResultError       = "error"
+)
+
+// metrics of the cluster API calls, token refreshes and bundle downloads
+type metrics struct {
+	requests             metric.Int64Counter
+	requestDuration      metric.Float64Histogram
+	tokenRefreshes       metric.Int64Counter
+	tokenRefreshFailures metric.Int64Counter
+	downloads            metric.Int64Counter
+	downloadBytes        metric.Int64Counter
+	downloadDuration     metric.Float64Histogram
+
+	// attrs are recorded with every measurement, i.e. to tell the clusters apart
+	attrs attribute.Set
+}
+
+// newMetrics creates the instruments with the meter of the given provider.
+// Failing that, the error is reported to the global OpenTelemetry error handler,
+// and the metrics are not recorded.
+func newMetrics(mp metric.MeterProvider, attrs []attribute.KeyValue) *metrics {
+	m, err := createMetrics(mp.Meter(instrumentationName), attribute.NewSet(attrs...))
+	if err != nil {
+		otel.Handle(err)
+		m, _ = createMetrics(noop.NewMeterProvider().Meter(instrumentationName), attribute.NewSet(attrs...))
+	}
+	return m
+}
+
+func createMetrics(meter metric.Meter, attrs attribute.Set) (*metrics, error) {
+	m := &metrics{attrs: attrs}
+
+	var errs *multierror.Error
+	var err error
+	m.requests, err = meter.Int64Counter("zero.cluster_api.requests",
+		metric.WithDescription("Number of cluster API requests, by operation and status code"))
+	errs = multierror.Append(errs, err)
+	m.requestDuration, err = meter.Float64Histogram("zero.cluster_api.request.duration",
+		metric.WithDescription("Duration of cluster API requests, by operation and status code"),
+		metric.WithUnit("s"))
+	errs = multierror.Append(errs, err)
+	m.tokenRefreshes, err = meter.Int64Counter("zero.token.refreshes",
+		metric.WithDescription("Number of attempts to exchange the API token for an identity token"))
+	errs = multierror.Append(errs, err)
+	m.tokenRefreshFailures, err = meter.Int64Counter("zero.token.refresh.failures",
+		metric.WithDescription("Number of failed attempts to exchange the API token for an identity token"))
+	errs = multierror.Append(errs, err)
+	m.downloads, err = meter.Int64Counter("zero.bundle.downloads",
+		metric.WithDescription("Number of bundle downloads, by result: modified, not_modified or error"))
+	errs = multierror.Append(errs, err)
+	m.downloadBytes, err = meter.Int64Counter("zero.bundle.download.size",
+		metric.WithDescription("Total size of the successfully downloaded bundles"),
+		metric.WithUnit("By"))
+	errs = multierror.Append(errs, err)
+	m.downloadDuration, err = meter.Float64Histogram("zero.bundle.download.duration",
+		metric.WithDescription("Duration of bundle downloads, by result"),
+		metric.WithUnit("s"))
+	errs = multierror.Append(errs, err)
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type operationContextKey struct{}
+
+// contextWithOperation sets the cluster API operation name, that the requests metrics are recorded with
+func contextWithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationContextKey{}, operation)
+}
+
+func operationFromContext(ctx context.Context) string {
+	if operation, ok := ctx.Value(operationContextKey{}).(string); ok {
+		return operation
+	}
+	return "unknown"
+}
+
+func (m *metrics) recordDownload(ctx context.Context, start time.Time, result string, size int64) {
+	attrs := metric.WithAttributes(attribute.String("zero.bundle.result", result))
+	m.downloads.Add(ctx, 1, metric.WithAttributeSet(m.attrs), attrs)
+	m.downloadDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributeSet(m.attrs), attrs)
+	if size > 0 {
+		m.downloadBytes.Add(ctx, size, metric.WithAttributeSet(m.attrs))
+	}
+}
+
+// meterFetcher wraps the token fetcher to count the token refreshes and failures
+func meterFetcher(m *metrics, fetcher token_api.Fetcher) token_api.Fetcher {
+	return func(ctx context.Context, refreshToken string) (*token_api.Token, error) {
+		token, err := fetcher(ctx, refreshToken)
+		m.tokenRefreshes.Add(ctx, 1, metric.WithAttributeSet(m.attrs))
+		if err != nil {
+			m.tokenRefreshFailures.Add(ctx, 1, metric.WithAttributeSet(m.attrs))
+		}
+		return token, err
+	}
+}
+
+// metricsTransport records the count and duration of each cluster API request
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics *metrics
+}
+
+func newMetricsClient(client *http.Client, m *metrics) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	c := *client
+	c.Transport = &metricsTransport{base: base, metrics: m}
+	return &c
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	// the status code is 0 if no response was received
+	var status int
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("zero.operation", operationFromContext(ctx)),
+		attribute.Int("http.status_code", status),
+	)
+	t.metrics.requests.Add(ctx, 1, metric.WithAttributeSet(t.metrics.attrs), attrs)
+	t.metrics.requestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributeSet(t.metrics.attrs), attrs)
+	return resp, err
+}
@@ -0,0 +1,197 @@
+package zerosdk_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	connect_mux "github.com/pomerium/zero-sdk/connect-mux"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+// collectSums returns the values of the int64 sums and gauges by metric name and attribute value
+func collectSums(t *testing.T, reader sdkmetric.Reader, key attribute.Key) map[string]map[string]int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	values := map[string]map[string]int64{}
+	add := func(name string, points []metricdata.DataPoint[int64]) {
+		values[name] = map[string]int64{}
+		for _, dp := range points {
+			var label string
+			if v, ok := dp.Attributes.Value(key); ok {
+				label = v.Emit()
+			}
+			values[name][label] += dp.Value
+		}
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				add(m.Name, data.DataPoints)
+			case metricdata.Gauge[int64]:
+				add(m.Name, data.DataPoints)
+			}
+		}
+	}
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+
+	api := newTestAPI(t, srv, zerosdk.WithMeterProvider(mp))
+
+	t.Run("cluster API requests", func(t *testing.T) {
+		_, err := api.GetClusterBootstrapConfig(ctx)
+		require.NoError(t, err)
+
+		srv.InjectError("GetClusterResourceBundles", http.StatusInternalServerError, 1)
+		_, err = api.GetClusterResourceBundles(ctx)
+		require.Error(t, err)
+
+		requests := collectSums(t, reader, "zero.operation")["zero.cluster_api.requests"]
+		assert.Equal(t, int64(1), requests["exchangeClusterIdentityToken"])
+		assert.Equal(t, int64(1), requests["getClusterBootstrapConfig"])
+		assert.Equal(t, int64(1), requests["getClusterResourceBundles"])
+
+		statuses := collectSums(t, reader, "http.status_code")["zero.cluster_api.requests"]
+		assert.Equal(t, int64(1), statuses["500"])
+
+		assert.Equal(t, int64(1), collectSums(t, reader, "")["zero.token.refreshes"][""])
+	})
+
+	t.Run("bundle downloads", func(t *testing.T) {
+		var buf bytes.Buffer
+		res, err := api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+		require.NoError(t, err)
+		_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", res.DownloadConditional)
+		require.NoError(t, err)
+		_, err = api.DownloadClusterResourceBundle(ctx, &buf, "missing", nil)
+		require.Error(t, err)
+
+		sums := collectSums(t, reader, "zero.bundle.result")
+		assert.Equal(t, map[string]int64{
+			"modified":     1,
+			"not_modified": 1,
+			"error":        1,
+		}, sums["zero.bundle.downloads"])
+		assert.Equal(t, int64(len("bundle-data")), sums["zero.bundle.download.size"][""])
+	})
+
+	t.Run("connect stream", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		t.Cleanup(cancel)
+		go func() { _ = api.Connect(ctx) }()
+
+		received := make(chan struct{}, 1)
+		go func() {
+			_ = api.Watch(ctx, connect_mux.WithOnBundleUpdated(func(_ context.Context, _ string) {
+				select {
+				case received <- struct{}{}:
+				default:
+				}
+			}))
+		}()
+
+		require.NoError(t, srv.WaitForStreams(ctx, 1))
+		require.Eventually(t, func() bool {
+			srv.PublishConfigUpdated(1)
+			select {
+			case <-received:
+				return true
+			case <-time.After(time.Millisecond * 50):
+				return false
+			}
+		}, time.Second*5, time.Millisecond)
+
+		sums := collectSums(t, reader, "zero.message.type")
+		assert.Equal(t, int64(1), sums["zero.connect.connects"][""])
+		assert.Equal(t, int64(1), sums["zero.connect.connected"][""])
+		assert.Equal(t, int64(1), sums["zero.connect.subscribers"][""])
+		assert.GreaterOrEqual(t, sums["zero.connect.messages"]["config_updated"], int64(1))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		require.NoError(t, api.Close())
+		gauges := collectSums(t, reader, "")
+		assert.Empty(t, gauges["zero.connect.connected"], "the closed API should not be observed")
+		assert.Empty(t, gauges["zero.connect.subscribers"], "the closed API should not be observed")
+	})
+}
+
+func TestManagerMetrics(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+
+	m, err := zerosdk.NewManager(zerosdk.WithMeterProvider(mp))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+
+	require.NoError(t, m.Add(ctx, "a", clusterOptions(srv)...))
+	require.NoError(t, m.Add(ctx, "b", clusterOptions(srv)...))
+	require.NoError(t, srv.WaitForStreams(ctx, 2))
+
+	connected := func() map[string]int64 {
+		return collectSums(t, reader, "zero.cluster")["zero.connect.connected"]
+	}
+	require.Eventually(t, func() bool {
+		c := connected()
+		return c["a"] == 1 && c["b"] == 1
+	}, time.Second*5, time.Millisecond*10, "the clusters should be told apart")
+
+	for _, key := range []string{"a", "b"} {
+		api, ok := m.Get(key)
+		require.True(t, ok)
+		_, err := api.GetClusterBootstrapConfig(ctx)
+		require.NoError(t, err)
+		_, err = api.DownloadClusterResourceBundle(ctx, io.Discard, "config", nil)
+		require.NoError(t, err)
+	}
+	sums := collectSums(t, reader, "zero.cluster")
+	for _, name := range []string{
+		"zero.cluster_api.requests",
+		"zero.token.refreshes",
+		"zero.bundle.downloads",
+		"zero.bundle.download.size",
+	} {
+		assert.Equal(t, sums[name]["a"], sums[name]["b"], name)
+		assert.NotZero(t, sums[name]["a"], name)
+		assert.Zero(t, sums[name][""], name)
+	}
+
+	require.NoError(t, m.Remove("b"))
+	require.Eventually(t, func() bool {
+		_, ok := connected()["b"]
+		return !ok
+	}, time.Second*5, time.Millisecond*10, "the removed cluster should not be observed")
+	assert.Equal(t, int64(1), connected()["a"])
+}
@@ -0,0 +1,224 @@
+package zerosdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pomerium/zero-sdk/apierror"
+	"github.com/pomerium/zero-sdk/clock"
+)
+
+const maxDrainBodySize = 2 << 12 // 8kb
+
+// RetryPolicy configures how the cluster API calls are retried.
+// Server errors (5xx) and network errors are retried with an exponential backoff,
+// 429 and 503 responses honour the Retry-After header,
+// and any other response or a terminal error is returned immediately.
+// The unset fields take their value from DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts, including the first one
+	MaxAttempts int
+	// MaxElapsedTime is the max total time spent retrying
+	MaxElapsedTime time.Duration
+	// InitialInterval is the interval before the first retry
+	InitialInterval time.Duration
+	// MaxInterval caps the interval between retries
+	MaxInterval time.Duration
+	// Multiplier is the factor the interval grows with after each attempt
+	Multiplier float64
+	// RandomizationFactor is the jitter applied to the interval, i.e. 0.5 means +/-50%
+	RandomizationFactor float64
+}
+
+// NoRetry is the retry policy that makes exactly one attempt
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// DefaultRetryPolicy returns a retry policy suitable for most cluster API calls
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:         5,
+		MaxElapsedTime:      time.Minute,
+		InitialInterval:     backoff.DefaultInitialInterval,
+		MaxInterval:         time.Second * 10,
+		Multiplier:          backoff.DefaultMultiplier,
+		RandomizationFactor: backoff.DefaultRandomizationFactor,
+	}
+}
+
+type retryPolicyContextKey struct{}
+
+// ContextWithRetryPolicy overrides the retry policy for the cluster API calls made with the returned context
+func ContextWithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyContextKey{}, policy)
+}
+
+// withDefaults fills the unset, or invalid, fields of the policy from DefaultRetryPolicy,
+// so that a partial policy neither retries back-to-back nor forever
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	def := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.MaxElapsedTime <= 0 {
+		p.MaxElapsedTime = def.MaxElapsedTime
+	}
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = def.InitialInterval
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = def.MaxInterval
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = def.Multiplier
+	}
+	if p.RandomizationFactor < 0 {
+		p.RandomizationFactor = def.RandomizationFactor
+	}
+	return p
+}
+
+func (p RetryPolicy) newBackOff(clk clock.Clock) *backoff.ExponentialBackOff {
+	bo := backoff.NewExponentialBackOff()
+	bo.Clock = clk
+	bo.InitialInterval = p.InitialInterval
+	bo.MaxInterval = p.MaxInterval
+	bo.Multiplier = p.Multiplier
+	bo.RandomizationFactor = p.RandomizationFactor
+	bo.MaxElapsedTime = p.MaxElapsedTime
+	bo.Reset()
+	return bo
+}
+
+// retryTransport retries the cluster API requests according to the retry policy
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+	clock  clock.Clock
+}
+
+func newRetryClient(client *http.Client, policy RetryPolicy, clk clock.Clock) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	c := *client
+	c.Transport = &retryTransport{base: base, policy: policy, clock: clk}
+	return &c
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	policy := t.policy
+	if p, ok := ctx.Value(retryPolicyContextKey{}).(RetryPolicy); ok {
+		policy = p
+	}
+	policy = policy.withDefaults()
+	if policy.MaxAttempts == 1 {
+		return t.base.RoundTrip(req)
+	}
+
+	bo := policy.newBackOff(t.clock)
+	for attempt := 1; ; attempt++ {
+		r, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		retryAfter, retry := shouldRetry(ctx, t.clock, resp, err)
+		if !retry || attempt == policy.MaxAttempts || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		next := bo.NextBackOff()
+		if next == backoff.Stop {
+			return resp, err
+		}
+		if retryAfter > next {
+			if policy.MaxElapsedTime > 0 && bo.GetElapsedTime()+retryAfter > policy.MaxElapsedTime {
+				return resp, err
+			}
+			next = retryAfter
+		}
+
+		if resp != nil {
+			drainBody(resp)
+		}
+
+		timer := t.clock.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// rewindRequest returns the request to use for the given attempt, with a fresh copy of the body
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 1 || req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// shouldRetry returns whether the request should be retried,
+// and the minimum interval before the retry requested by the server
+func shouldRetry(ctx context.Context, clk clock.Clock, resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		if ctx.Err() != nil || apierror.IsTerminalError(err) || errors.Is(err, context.Canceled) {
+			return 0, false
+		}
+		return 0, true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return parseRetryAfter(clk, resp.Header.Get("Retry-After")), true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// parseRetryAfter parses Retry-After header, that may be either a number of seconds or an HTTP date
+func parseRetryAfter(clk clock.Clock, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if tm, err := http.ParseTime(value); err == nil {
+		if d := clk.Until(tm); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// drainBody reads and closes the response body, so that the connection may be reused
+func drainBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBodySize))
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,165 @@
+package zerosdk_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func testRetryPolicy() zerosdk.RetryPolicy {
+	policy := zerosdk.DefaultRetryPolicy()
+	policy.InitialInterval = time.Millisecond
+	policy.MaxInterval = time.Millisecond * 10
+	return policy
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	api := newTestAPI(t, srv, zerosdk.WithRetryPolicy(testRetryPolicy()))
+
+	// warm up the token cache
+	_, err := api.GetClusterResourceBundles(ctx)
+	require.NoError(t, err)
+
+	t.Run("server errors are retried", func(t *testing.T) {
+		before := srv.RequestCount("GetClusterBootstrapConfig")
+		srv.InjectError("GetClusterBootstrapConfig", http.StatusInternalServerError, 2)
+		_, err := api.GetClusterBootstrapConfig(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, srv.RequestCount("GetClusterBootstrapConfig")-before)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		before := srv.RequestCount("GetClusterBootstrapConfig")
+		srv.InjectError("GetClusterBootstrapConfig", http.StatusBadGateway, -1)
+		t.Cleanup(srv.ClearErrors)
+		_, err := api.GetClusterBootstrapConfig(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, 5, srv.RequestCount("GetClusterBootstrapConfig")-before)
+	})
+
+	t.Run("bad request is terminal", func(t *testing.T) {
+		before := srv.RequestCount("GetClusterBootstrapConfig")
+		srv.InjectError("GetClusterBootstrapConfig", http.StatusBadRequest, 1)
+		_, err := api.GetClusterBootstrapConfig(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, 1, srv.RequestCount("GetClusterBootstrapConfig")-before)
+	})
+
+	t.Run("request body is replayed", func(t *testing.T) {
+		before := len(srv.BundleStatuses("config"))
+		srv.InjectError("ReportClusterResourceBundleStatus", http.StatusInternalServerError, 1)
+		require.NoError(t, api.ReportBundleAppliedSuccess(ctx, "config", map[string]string{"k": "v"}))
+		statuses := srv.BundleStatuses("config")
+		require.Len(t, statuses, before+1)
+		assert.Equal(t, map[string]string{"k": "v"}, statuses[before].Success.Metadata)
+	})
+
+	t.Run("per call override", func(t *testing.T) {
+		before := srv.RequestCount("GetClusterBootstrapConfig")
+		srv.InjectError("GetClusterBootstrapConfig", http.StatusInternalServerError, 1)
+		_, err := api.GetClusterBootstrapConfig(zerosdk.ContextWithRetryPolicy(ctx, zerosdk.NoRetry))
+		assert.Error(t, err)
+		assert.Equal(t, 1, srv.RequestCount("GetClusterBootstrapConfig")-before)
+	})
+
+	t.Run("partial policy", func(t *testing.T) {
+		before := srv.RequestCount("GetClusterBootstrapConfig")
+		srv.InjectError("GetClusterBootstrapConfig", http.StatusInternalServerError, -1)
+		t.Cleanup(srv.ClearErrors)
+
+		start := time.Now()
+		_, err := api.GetClusterBootstrapConfig(zerosdk.ContextWithRetryPolicy(ctx, zerosdk.RetryPolicy{MaxAttempts: 3}))
+		assert.Error(t, err)
+		assert.Equal(t, 3, srv.RequestCount("GetClusterBootstrapConfig")-before)
+		// the default intervals of 500ms and 750ms, with the +/-50% jitter
+		assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*625, "retries should back off")
+	})
+
+	t.Run("negative max attempts", func(t *testing.T) {
+		before := srv.RequestCount("GetClusterBootstrapConfig")
+		srv.InjectError("GetClusterBootstrapConfig", http.StatusInternalServerError, -1)
+		t.Cleanup(srv.ClearErrors)
+
+		policy := testRetryPolicy()
+		policy.MaxAttempts = -1
+		_, err := api.GetClusterBootstrapConfig(zerosdk.ContextWithRetryPolicy(ctx, policy))
+		assert.Error(t, err)
+		assert.Equal(t, zerosdk.DefaultRetryPolicy().MaxAttempts, srv.RequestCount("GetClusterBootstrapConfig")-before)
+	})
+}
+
+type retryAfterTransport struct {
+	base       http.RoundTripper
+	retryAfter string
+	remaining  atomic.Int32
+	calls      atomic.Int32
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/bootstrap") {
+		return t.base.RoundTrip(req)
+	}
+	t.calls.Add(1)
+	if t.remaining.Add(-1) < 0 {
+		return t.base.RoundTrip(req)
+	}
+	return &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {t.retryAfter}},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+
+	for _, tc := range []struct {
+		name       string
+		retryAfter string
+		wantErr    bool
+		wantCalls  int32
+	}{
+		{"retry after elapsed", "0", false, 2},
+		{"retry after exceeds max elapsed time", "3600", true, 1},
+		{"http date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), false, 2},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport := &retryAfterTransport{base: http.DefaultTransport, retryAfter: tc.retryAfter}
+			transport.remaining.Store(1)
+
+			api := newTestAPI(t, srv,
+				zerosdk.WithHTTPClient(&http.Client{Transport: transport}),
+				zerosdk.WithRetryPolicy(testRetryPolicy()),
+			)
+
+			_, err := api.GetClusterBootstrapConfig(ctx)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantCalls, transport.calls.Load())
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package zerosdk
+
+import (
+	"time"
+
+	connect_mux "github.com/pomerium/zero-sdk/connect-mux"
+)
+
+// Status is the snapshot of the API state, that may be used for readiness probes
+type Status struct {
+	// Status is the state of the connection to the connect API
+	connect_mux.Status
+	// TokenExpires is the expiration time of the current identity token, zero if none was fetched yet
+	TokenExpires time.Time
+	// DownloadURLs maps the IDs of the bundles with a cached download URL to the time the URL expires
+	DownloadURLs map[string]time.Time
+	// Closed is true once the API is closed
+	Closed bool
+}
+
+// Status returns the snapshot of the API state
+func (api *API) Status() Status {
+	urls := make(map[string]time.Time)
+	for id, entry := range api.downloadURLCache.Entries() {
+		urls[id] = entry.ExpiresAt
+	}
+
+	return Status{
+		Status:       api.mux.Status(),
+		TokenExpires: api.tokenCache.Expires(),
+		DownloadURLs: urls,
+		Closed:       api.isClosed(),
+	}
+}
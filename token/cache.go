@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"sync/atomic"
 	"time"
+
+	"github.com/pomerium/zero-sdk/clock"
 )
 
 const (
@@ -14,8 +16,12 @@ const (
 // Cache is a thread-safe cache of a authorization token
 // that may be used across http and grpc clients
 type Cache struct {
+	// TimeNow overrides the clock time if set.
+	//
+	// Deprecated: use WithClock.
 	TimeNow func() time.Time
 
+	clock        clock.Clock
 	refreshToken string
 	fetcher      Fetcher
 
@@ -34,19 +40,43 @@ func (t *Token) ExpiresAfter(tm time.Time) bool {
 	return t != nil && t.Expires.After(tm)
 }
 
-func NewCache(fetcher Fetcher, refreshToken string) *Cache {
-	return &Cache{
+// CacheOption configures the Cache
+type CacheOption func(*Cache)
+
+// WithClock sets the clock the token expiration is checked against
+func WithClock(c clock.Clock) CacheOption {
+	return func(cache *Cache) {
+		cache.clock = c
+	}
+}
+
+func NewCache(fetcher Fetcher, refreshToken string, opts ...CacheOption) *Cache {
+	c := &Cache{
+		clock:        clock.Real(),
 		lock:         make(chan struct{}, 1),
 		fetcher:      fetcher,
 		refreshToken: refreshToken,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *Cache) timeNow() time.Time {
 	if c.TimeNow != nil {
 		return c.TimeNow()
 	}
-	return time.Now()
+	return c.clock.Now()
+}
+
+// Expires returns the expiration time of the current token, or zero time if no token was fetched yet
+func (c *Cache) Expires() time.Time {
+	token, ok := c.token.Load().(*Token)
+	if !ok {
+		return time.Time{}
+	}
+	return token.Expires
 }
 
 // GetToken returns the current token if its at least `minTTL` from expiration, or fetches a new one.
@@ -71,7 +101,7 @@ func (c *Cache) forceRefreshToken(ctx context.Context, minExpiration time.Time)
 		<-c.lock
 	}()
 
-	ctx, cancel := context.WithTimeout(ctx, maxLockWait)
+	ctx, cancel := clock.WithTimeout(ctx, c.clock, maxLockWait)
 	defer cancel()
 
 	token, ok := c.token.Load().(*Token)
@@ -31,10 +31,13 @@ func TestCache(t *testing.T) {
 		now := time.Now()
 		c.TimeNow = func() time.Time { return now }
 
+		assert.True(t, c.Expires().IsZero(), "no token was fetched yet")
+
 		testToken = &token.Token{"bearer-1", now.Add(time.Hour)}
 		bearer, err := c.GetToken(context.Background(), time.Minute)
 		require.NoError(t, err)
 		assert.Equal(t, "bearer-1", bearer)
+		assert.Equal(t, now.Add(time.Hour), c.Expires())
 
 		now = now.Add(time.Minute * 30)
 		testToken.Bearer = "bearer-2"
@@ -0,0 +1,149 @@
+package zerosdk
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	token_api "github.com/pomerium/zero-sdk/token"
+)
+
+const instrumentationName = "github.com/pomerium/zero-sdk"
+
+// startSpan starts a span for the cluster API operation,
+// and sets the operation name for the requests metrics
+func (api *API) startSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = contextWithOperation(ctx, operation)
+	return api.tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceFetcher wraps the token fetcher with a span of the token exchange
+func traceFetcher(tracer trace.Tracer, fetcher token_api.Fetcher) token_api.Fetcher {
+	return func(ctx context.Context, refreshToken string) (*token_api.Token, error) {
+		const operation = "exchangeClusterIdentityToken"
+		ctx, span := tracer.Start(contextWithOperation(ctx, operation), operation, trace.WithSpanKind(trace.SpanKindClient))
+		token, err := fetcher(ctx, refreshToken)
+		endSpan(span, err)
+		return token, err
+	}
+}
+
+// tracingTransport creates a span for each HTTP request,
+// and propagates the trace context in the request headers if the propagator is set
+type tracingTransport struct {
+	base       http.RoundTripper
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func newTracingClient(client *http.Client, tracer trace.Tracer, propagator propagation.TextMapPropagator) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	c := *client
+	c.Transport = &tracingTransport{base: base, tracer: tracer, propagator: propagator}
+	return &c
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			// the query is omitted, as signed URLs carry credentials in it
+			attribute.String("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	if t.propagator != nil {
+		t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if id := resp.Header.Get("X-Response-Id"); id != "" {
+		span.SetAttributes(attribute.String("zero.response_id", id))
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// streamClientInterceptor propagates the trace context in the outgoing gRPC stream metadata
+func streamClientInterceptor(propagator propagation.TextMapPropagator) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		md, ok := metadata.FromOutgoingContext(ctx)
+		if ok {
+			md = md.Copy()
+		} else {
+			md = metadata.MD{}
+		}
+		propagator.Inject(ctx, metadataCarrier(md))
+		return streamer(metadata.NewOutgoingContext(ctx, md), desc, cc, method, opts...)
+	}
+}
+
+// metadataCarrier adapts gRPC metadata to propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+var _ propagation.TextMapCarrier = metadataCarrier{}
+
+// Get implements propagation.TextMapCarrier
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Set implements propagation.TextMapCarrier
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys implements propagation.TextMapCarrier
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,107 @@
+package zerosdk_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+// headerRecorder records the trace context headers of the outgoing requests by path
+type headerRecorder struct {
+	base http.RoundTripper
+
+	mx      sync.Mutex
+	headers map[string]string
+}
+
+func (r *headerRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mx.Lock()
+	r.headers[req.URL.Path] = req.Header.Get("traceparent")
+	r.mx.Unlock()
+	return r.base.RoundTrip(req)
+}
+
+func (r *headerRecorder) get(path string) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.headers[path]
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = tp.Shutdown(ctx) })
+
+	client := *http.DefaultClient
+	headers := &headerRecorder{base: http.DefaultTransport, headers: map[string]string{}}
+	client.Transport = headers
+
+	api := newTestAPI(t, srv,
+		zerosdk.WithHTTPClient(&client),
+		zerosdk.WithTracerProvider(tp),
+		zerosdk.WithPropagator(propagation.TraceContext{}),
+	)
+
+	_, err := api.GetClusterBootstrapConfig(ctx)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+	require.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{
+		"exchangeClusterIdentityToken",
+		"getClusterBootstrapConfig",
+		"downloadClusterResourceBundle",
+		"bundle.download",
+		"HTTP GET",
+		"HTTP POST",
+	} {
+		assert.Contains(t, spans, name)
+	}
+
+	download := spans["bundle.download"]
+	urlSpan := spans["downloadClusterResourceBundle"]
+	assert.Equal(t, download.SpanContext().SpanID(), urlSpan.Parent().SpanID(),
+		"the download URL request should be a child of the download span")
+
+	t.Run("trace context is propagated to the cluster API only", func(t *testing.T) {
+		assert.NotEmpty(t, headers.get("/cluster/v1/bootstrap"))
+		for path, value := range headers.headers {
+			if strings.HasPrefix(path, "/blobs/") {
+				assert.Empty(t, value, path)
+			}
+		}
+	})
+
+	t.Run("signed URL query is not recorded", func(t *testing.T) {
+		for _, span := range recorder.Ended() {
+			for _, attr := range span.Attributes() {
+				if attr.Key == "http.url" {
+					assert.NotContains(t, attr.Value.AsString(), "signature")
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package zerosdk_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/zerotest"
+)
+
+func TestTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t, zerotest.WithTLS())
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	endpoints := []zerosdk.Option{
+		zerosdk.WithClusterAPIEndpoint(srv.ClusterAPIEndpoint()),
+		zerosdk.WithConnectAPIEndpoint(srv.ConnectAPIEndpoint()),
+		zerosdk.WithAPIToken(srv.APIToken()),
+	}
+
+	t.Run("untrusted", func(t *testing.T) {
+		api, err := zerosdk.NewAPI(ctx, endpoints...)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = api.Close() })
+
+		_, err = api.GetClusterBootstrapConfig(ctx)
+		var certErr x509.UnknownAuthorityError
+		assert.ErrorAs(t, err, &certErr)
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	api, err := zerosdk.NewAPI(ctx, append(endpoints,
+		zerosdk.WithTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}),
+	)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = api.Close() })
+
+	_, err = api.GetClusterBootstrapConfig(ctx)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "bundle-data", buf.String())
+
+	go func() { _ = api.Connect(ctx) }()
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+}
+
+// testProxy is a forward proxy, that tunnels CONNECT requests and forwards the plain HTTP ones
+type testProxy struct {
+	mx    sync.Mutex
+	hosts map[string]string
+}
+
+func (p *testProxy) record(method, host string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.hosts[host] = method
+}
+
+func (p *testProxy) seen() map[string]string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	hosts := make(map[string]string, len(p.hosts))
+	for k, v := range p.hosts {
+		hosts[k] = v
+	}
+	return hosts
+}
+
+func (p *testProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.record(r.Method, r.Host)
+
+	if r.Method != http.MethodConnect {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+	_ = conn.Close()
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t)
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	proxy := &testProxy{hosts: map[string]string{}}
+	proxySrv := httptest.NewServer(proxy)
+	t.Cleanup(proxySrv.Close)
+	proxyURL, err := url.Parse(proxySrv.URL)
+	require.NoError(t, err)
+
+	api, err := zerosdk.NewAPI(ctx,
+		zerosdk.WithClusterAPIEndpoint(srv.ClusterAPIEndpoint()),
+		zerosdk.WithConnectAPIEndpoint(srv.ConnectAPIEndpoint()),
+		zerosdk.WithAPIToken(srv.APIToken()),
+		zerosdk.WithProxy(http.ProxyURL(proxyURL)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = api.Close() })
+
+	var buf bytes.Buffer
+	_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+	require.NoError(t, err)
+
+	go func() { _ = api.Connect(ctx) }()
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+
+	clusterURL, err := url.Parse(srv.ClusterAPIEndpoint())
+	require.NoError(t, err)
+	connectURL, err := url.Parse(srv.ConnectAPIEndpoint())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		clusterURL.Host: http.MethodGet,
+		connectURL.Host: http.MethodConnect,
+	}, proxy.seen())
+}
+
+func TestHTTPSProxy(t *testing.T) {
+	t.Parallel()
+
+	ctx := testContext(t)
+	srv := zerotest.NewServer(t, zerotest.WithTLS())
+	srv.SetBundle("config", []byte("bundle-data"))
+
+	// both the proxy and the server certificates are issued by the private CAs
+	proxy := &testProxy{hosts: map[string]string{}}
+	proxySrv := httptest.NewUnstartedServer(proxy)
+	proxySrv.StartTLS()
+	t.Cleanup(proxySrv.Close)
+	proxyURL, err := url.Parse(proxySrv.URL)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	roots.AddCert(proxySrv.Certificate())
+	api, err := zerosdk.NewAPI(ctx,
+		zerosdk.WithClusterAPIEndpoint(srv.ClusterAPIEndpoint()),
+		zerosdk.WithConnectAPIEndpoint(srv.ConnectAPIEndpoint()),
+		zerosdk.WithAPIToken(srv.APIToken()),
+		zerosdk.WithTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}),
+		zerosdk.WithProxy(http.ProxyURL(proxyURL)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = api.Close() })
+
+	var buf bytes.Buffer
+	_, err = api.DownloadClusterResourceBundle(ctx, &buf, "config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "bundle-data", buf.String())
+
+	go func() { _ = api.Connect(ctx) }()
+	require.NoError(t, srv.WaitForStreams(ctx, 1))
+
+	connectURL, err := url.Parse(srv.ConnectAPIEndpoint())
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodConnect, proxy.seen()[connectURL.Host])
+}
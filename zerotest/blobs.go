@@ -0,0 +1,289 @@
+package zerotest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/klauspost/compress/zstd"
+)
+
+// bundle is a resource bundle stored in the fake cloud storage
+type bundle struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	encoding     string
+	metadata     map[string]string
+	checksum     string
+}
+
+// BundleOption configures a bundle stored with SetBundle
+type BundleOption func(*bundle)
+
+// WithBundleMetadata sets the headers that would be returned along with the bundle body,
+// and which the client is asked to capture as the bundle metadata
+func WithBundleMetadata(headers map[string]string) BundleOption {
+	return func(b *bundle) {
+		for k, v := range headers {
+			b.metadata[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+}
+
+// WithBundleGzip stores the bundle gzip compressed,
+// and serves it with Content-Encoding: gzip to the clients that accept it
+func WithBundleGzip() BundleOption {
+	return func(b *bundle) {
+		b.encoding = "gzip"
+	}
+}
+
+// WithBundleZstd stores the bundle zstd compressed,
+// and serves it with Content-Encoding: zstd to the clients that accept it
+func WithBundleZstd() BundleOption {
+	return func(b *bundle) {
+		b.encoding = "zstd"
+	}
+}
+
+// WithBundleChecksum overrides the checksum returned along with the download URL,
+// that is the sha256 digest of the bundle content by default. Empty checksum is not returned.
+func WithBundleChecksum(checksum string) BundleOption {
+	return func(b *bundle) {
+		b.checksum = checksum
+	}
+}
+
+// SetBundle creates or replaces a resource bundle.
+// It does not notify the connected clients, see PublishConfigUpdated.
+func (srv *Server) SetBundle(id string, data []byte, opts ...BundleOption) {
+	sum := sha256.Sum256(data)
+	b := &bundle{
+		data:         append([]byte(nil), data...),
+		etag:         strconv.Quote(hex.EncodeToString(sum[:16])),
+		lastModified: srv.cfg.clock.Now().UTC().Truncate(time.Second),
+		metadata:     make(map[string]string),
+		checksum:     "sha256:" + hex.EncodeToString(sum[:]),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	switch b.encoding {
+	case "gzip":
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		b.data = buf.Bytes()
+	case "zstd":
+		zw, _ := zstd.NewWriter(nil)
+		b.data = zw.EncodeAll(data, nil)
+		_ = zw.Close()
+	}
+
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.bundles[id] = b
+}
+
+// RemoveBundle removes a resource bundle
+func (srv *Server) RemoveBundle(id string) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	delete(srv.bundles, id)
+}
+
+func (srv *Server) signedURL(id string) string {
+	expires := strconv.FormatInt(srv.cfg.clock.Now().Add(srv.cfg.downloadURLTTL).Unix(), 10)
+	q := url.Values{
+		"expires":   {expires},
+		"signature": {srv.sign(id, expires)},
+	}
+	return srv.http.URL + blobsBasePath + "/" + url.PathEscape(id) + "?" + q.Encode()
+}
+
+func (srv *Server) sign(id, expires string) string {
+	h := hmac.New(sha256.New, srv.signKey)
+	_, _ = h.Write([]byte(id + "\n" + expires))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// serveBlob mimics a cloud storage serving signed URLs
+func (srv *Server) serveBlob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "bundleId")
+	srv.mx.Lock()
+	srv.blobRequests[id]++
+	srv.mx.Unlock()
+
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	if !hmac.Equal([]byte(signature), []byte(srv.sign(id, expires))) {
+		writeStorageError(w, http.StatusForbidden, "SignatureDoesNotMatch",
+			"The request signature we calculated does not match the signature you provided.")
+		return
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || srv.cfg.clock.Now().Unix() > expiresAt {
+		writeStorageError(w, http.StatusBadRequest, "ExpiredToken", "The provided token has expired.")
+		return
+	}
+
+	srv.mx.Lock()
+	b, ok := srv.bundles[id]
+	srv.mx.Unlock()
+
+	if !ok {
+		writeStorageError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	if b.encoding != "" {
+		if !acceptsEncoding(r, b.encoding) {
+			writeStorageError(w, http.StatusNotAcceptable, "NotAcceptable",
+				fmt.Sprintf("The object is only available %s encoded.", b.encoding))
+			return
+		}
+		w.Header().Set("Content-Encoding", b.encoding)
+	}
+	for k, v := range b.metadata {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", b.etag)
+
+	srv.mx.Lock()
+	hold := srv.holds[id]
+	srv.mx.Unlock()
+	if hold != nil {
+		select {
+		case <-hold:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if interrupt := srv.nextInterruption(id); interrupt != nil {
+		w = &interruptingWriter{ResponseWriter: w, remaining: interrupt.after, onInterrupted: interrupt.onInterrupted}
+	}
+	http.ServeContent(w, r, "", b.lastModified, bytes.NewReader(b.data))
+}
+
+// DownloadCount returns the number of requests made to download the bundle from the storage
+func (srv *Server) DownloadCount(id string) int {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	return srv.blobRequests[id]
+}
+
+// HoldDownloads makes the bundle downloads wait until the returned release function is called
+func (srv *Server) HoldDownloads(id string) (release func()) {
+	hold := make(chan struct{})
+
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.holds[id] = hold
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			srv.mx.Lock()
+			defer srv.mx.Unlock()
+
+			delete(srv.holds, id)
+			close(hold)
+		})
+	}
+}
+
+// interruption drops the bundle download connections
+type interruption struct {
+	after         int64
+	times         int
+	onInterrupted func()
+}
+
+// InterruptDownloads makes the next downloads of the bundle drop the connection
+// once the given number of the body bytes was sent, as served, i.e. gzip compressed.
+// onInterrupted is called once the connection is dropped, and may be nil.
+func (srv *Server) InterruptDownloads(id string, after int64, times int, onInterrupted func()) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.interruptions[id] = &interruption{after: after, times: times, onInterrupted: onInterrupted}
+}
+
+func (srv *Server) nextInterruption(id string) *interruption {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	i, ok := srv.interruptions[id]
+	if !ok || i.times <= 0 {
+		return nil
+	}
+	i.times--
+	return i
+}
+
+// interruptingWriter aborts the response once the given number of bytes was written
+type interruptingWriter struct {
+	http.ResponseWriter
+	remaining     int64
+	onInterrupted func()
+}
+
+func (w *interruptingWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= w.remaining {
+		w.remaining -= int64(len(p))
+		return w.ResponseWriter.Write(p)
+	}
+
+	_, _ = w.ResponseWriter.Write(p[:w.remaining])
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	if w.onInterrupted != nil {
+		w.onInterrupted()
+	}
+	// the server closes the connection without completing the response
+	panic(http.ErrAbortHandler)
+}
+
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.SplitN(enc, ";", 2)[0]) == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+type storageError struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+	Details string   `xml:"Details,omitempty"`
+}
+
+func writeStorageError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml; charset=UTF-8")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprint(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(storageError{Code: code, Message: message})
+}
@@ -0,0 +1,140 @@
+package zerotest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+)
+
+var _ cluster_api.StrictServerInterface = (*Server)(nil)
+
+// GetClusterBootstrapConfig implements cluster_api.StrictServerInterface
+func (srv *Server) GetClusterBootstrapConfig(
+	_ context.Context,
+	_ cluster_api.GetClusterBootstrapConfigRequestObject,
+) (cluster_api.GetClusterBootstrapConfigResponseObject, error) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	return cluster_api.GetClusterBootstrapConfig200JSONResponse(srv.bootstrap), nil
+}
+
+// GetClusterResourceBundles implements cluster_api.StrictServerInterface
+func (srv *Server) GetClusterResourceBundles(
+	_ context.Context,
+	_ cluster_api.GetClusterResourceBundlesRequestObject,
+) (cluster_api.GetClusterResourceBundlesResponseObject, error) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	bundles := make([]cluster_api.Bundle, 0, len(srv.bundles))
+	for id := range srv.bundles {
+		bundles = append(bundles, cluster_api.Bundle{Id: id})
+	}
+	sort.Slice(bundles, func(i, j int) bool { return bundles[i].Id < bundles[j].Id })
+
+	return cluster_api.GetClusterResourceBundles200JSONResponse{Bundles: bundles}, nil
+}
+
+// DownloadClusterResourceBundle implements cluster_api.StrictServerInterface
+func (srv *Server) DownloadClusterResourceBundle(
+	_ context.Context,
+	request cluster_api.DownloadClusterResourceBundleRequestObject,
+) (cluster_api.DownloadClusterResourceBundleResponseObject, error) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	b, ok := srv.bundles[request.BundleId]
+	if !ok {
+		return cluster_api.DownloadClusterResourceBundle404JSONResponse{Error: "bundle not found"}, nil
+	}
+
+	captureHeaders := make([]string, 0, len(b.metadata))
+	for k := range b.metadata {
+		captureHeaders = append(captureHeaders, k)
+	}
+	sort.Strings(captureHeaders)
+
+	resp := cluster_api.DownloadClusterResourceBundle200JSONResponse{
+		Url:                    srv.signedURL(request.BundleId),
+		ExpiresInSeconds:       strconv.FormatInt(int64(srv.cfg.downloadURLTTL.Seconds()), 10),
+		CaptureMetadataHeaders: captureHeaders,
+	}
+	if b.checksum != "" {
+		checksum := b.checksum
+		resp.Checksum = &checksum
+	}
+	return resp, nil
+}
+
+// ReportClusterResourceBundleStatus implements cluster_api.StrictServerInterface
+func (srv *Server) ReportClusterResourceBundleStatus(
+	_ context.Context,
+	request cluster_api.ReportClusterResourceBundleStatusRequestObject,
+) (cluster_api.ReportClusterResourceBundleStatusResponseObject, error) {
+	status := *request.Body
+	if (status.Success == nil) == (status.Failure == nil) {
+		return cluster_api.ReportClusterResourceBundleStatus400JSONResponse{
+			Error: "exactly one of success or failure must be set",
+		}, nil
+	}
+
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.statuses[request.BundleId] = append(srv.statuses[request.BundleId], status)
+	return cluster_api.ReportClusterResourceBundleStatus204Response{}, nil
+}
+
+// ExchangeClusterIdentityToken implements cluster_api.StrictServerInterface
+func (srv *Server) ExchangeClusterIdentityToken(
+	_ context.Context,
+	request cluster_api.ExchangeClusterIdentityTokenRequestObject,
+) (cluster_api.ExchangeClusterIdentityTokenResponseObject, error) {
+	if request.Body.RefreshToken != srv.cfg.refreshToken {
+		return cluster_api.ExchangeClusterIdentityToken400JSONResponse{Error: "invalid refresh token"}, nil
+	}
+
+	token := srv.issueToken()
+	return cluster_api.ExchangeClusterIdentityToken200JSONResponse{
+		IdToken:          token,
+		ExpiresInSeconds: strconv.FormatInt(int64(srv.cfg.tokenTTL.Seconds()), 10),
+	}, nil
+}
+
+// errorResponse may be returned by any of the cluster API operations,
+// when the request is unauthorized or an error was injected
+type errorResponse struct {
+	status  int
+	message string
+}
+
+func (e errorResponse) visit(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	return json.NewEncoder(w).Encode(cluster_api.ErrorResponse{Error: e.message})
+}
+
+func (e errorResponse) VisitGetClusterBootstrapConfigResponse(w http.ResponseWriter) error {
+	return e.visit(w)
+}
+
+func (e errorResponse) VisitGetClusterResourceBundlesResponse(w http.ResponseWriter) error {
+	return e.visit(w)
+}
+
+func (e errorResponse) VisitDownloadClusterResourceBundleResponse(w http.ResponseWriter) error {
+	return e.visit(w)
+}
+
+func (e errorResponse) VisitReportClusterResourceBundleStatusResponse(w http.ResponseWriter) error {
+	return e.visit(w)
+}
+
+func (e errorResponse) VisitExchangeClusterIdentityTokenResponse(w http.ResponseWriter) error {
+	return e.visit(w)
+}
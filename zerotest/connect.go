@@ -0,0 +1,145 @@
+package zerotest
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	connect_api "github.com/pomerium/zero-sdk/connect"
+)
+
+const streamBufferSize = 64
+
+// stream is an active Connect subscription
+type stream struct {
+	messages chan *connect_api.Message
+	drop     chan struct{}
+}
+
+type connectServer struct {
+	connect_api.UnimplementedConnectServer
+	srv *Server
+}
+
+// Subscribe implements connect_api.ConnectServer
+func (cs *connectServer) Subscribe(_ *connect_api.SubscribeRequest, ss connect_api.Connect_SubscribeServer) error {
+	ctx := ss.Context()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var authorization string
+	if values := md.Get("authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+	if err := cs.srv.checkToken(authorization); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	s := &stream{
+		messages: make(chan *connect_api.Message, streamBufferSize),
+		drop:     make(chan struct{}),
+	}
+	cs.srv.addStream(s)
+	defer cs.srv.removeStream(s)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.drop:
+			return status.Error(codes.Unavailable, "stream dropped")
+		case msg := <-s.messages:
+			if err := ss.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (srv *Server) addStream(s *stream) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.streams[s] = struct{}{}
+}
+
+func (srv *Server) removeStream(s *stream) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	delete(srv.streams, s)
+}
+
+// StreamCount returns the number of currently active Connect subscriptions
+func (srv *Server) StreamCount() int {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	return len(srv.streams)
+}
+
+// WaitForStreams waits until there are at least n active Connect subscriptions,
+// so that the messages published afterwards are delivered to them
+func (srv *Server) WaitForStreams(ctx context.Context, n int) error {
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+
+	for srv.StreamCount() < n {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Publish sends the message to all currently active Connect subscriptions
+func (srv *Server) Publish(msg *connect_api.Message) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	for s := range srv.streams {
+		select {
+		case s.messages <- msg:
+		default:
+			// the subscriber cannot keep up, same as the real service would
+			close(s.drop)
+			delete(srv.streams, s)
+		}
+	}
+}
+
+// PublishConfigUpdated notifies subscribers the config bundle was updated
+func (srv *Server) PublishConfigUpdated(changesetVersion int64) {
+	srv.Publish(&connect_api.Message{
+		Message: &connect_api.Message_ConfigUpdated{
+			ConfigUpdated: &connect_api.ConfigUpdated{
+				ChangesetVersion: changesetVersion,
+			},
+		},
+	})
+}
+
+// PublishBootstrapConfigUpdated notifies subscribers the bootstrap config was updated
+func (srv *Server) PublishBootstrapConfigUpdated() {
+	srv.Publish(&connect_api.Message{
+		Message: &connect_api.Message_BootstrapConfigUpdated{
+			BootstrapConfigUpdated: &connect_api.BootstrapConfigUpdated{},
+		},
+	})
+}
+
+// DropStreams terminates all currently active Connect subscriptions with codes.Unavailable,
+// clients are expected to reconnect
+func (srv *Server) DropStreams() {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	for s := range srv.streams {
+		close(s.drop)
+		delete(srv.streams, s)
+	}
+}
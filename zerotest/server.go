@@ -0,0 +1,361 @@
+// Package zerotest provides an in-process fake of the Pomerium Zero cloud,
+// serving both the cluster HTTP API and the Connect gRPC service,
+// so that the SDK may be exercised end to end in tests.
+package zerotest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	zerosdk "github.com/pomerium/zero-sdk"
+	"github.com/pomerium/zero-sdk/clock"
+	cluster_api "github.com/pomerium/zero-sdk/cluster"
+	connect_api "github.com/pomerium/zero-sdk/connect"
+)
+
+const (
+	clusterAPIBasePath = "/cluster/v1"
+	blobsBasePath      = "/blobs"
+
+	defaultTokenTTL       = time.Hour
+	defaultDownloadURLTTL = time.Hour
+)
+
+// Server is a fake Zero cloud, that implements both cluster API and connect API
+type Server struct {
+	cfg config
+
+	http       *httptest.Server
+	grpc       *grpc.Server
+	grpcListen net.Listener
+
+	mx        sync.Mutex
+	idTokens  map[string]time.Time
+	bootstrap cluster_api.BootstrapConfig
+	bundles   map[string]*bundle
+	statuses  map[string][]cluster_api.BundleStatus
+	streams   map[*stream]struct{}
+	requests  map[string]int
+	failures  map[string]*injectedError
+	signKey   []byte
+
+	interruptions map[string]*interruption
+	holds         map[string]chan struct{}
+	blobRequests  map[string]int
+}
+
+// Option configures the fake server
+type Option func(*config)
+
+type config struct {
+	refreshToken   string
+	tokenTTL       time.Duration
+	downloadURLTTL time.Duration
+	tls            bool
+	clock          clock.Clock
+}
+
+// WithRefreshToken sets the cluster identity token that would be accepted by the token exchange
+func WithRefreshToken(token string) Option {
+	return func(cfg *config) {
+		cfg.refreshToken = token
+	}
+}
+
+// WithTokenTTL sets the TTL of the bearer tokens issued by the token exchange
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(cfg *config) {
+		cfg.tokenTTL = ttl
+	}
+}
+
+// WithDownloadURLTTL sets the TTL of the signed bundle download URLs
+func WithDownloadURLTTL(ttl time.Duration) Option {
+	return func(cfg *config) {
+		cfg.downloadURLTTL = ttl
+	}
+}
+
+// WithTLS serves both the cluster API and the connect API over TLS,
+// with a self-signed certificate, see Server.Certificate
+func WithTLS() Option {
+	return func(cfg *config) {
+		cfg.tls = true
+	}
+}
+
+// WithClock sets the clock the tokens and the signed download URLs expire by.
+// The clock is also passed to the API by Options, so that the tests may control the expiration.
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// NewServer starts a new fake Zero cloud, that is stopped when the test completes
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	cfg := config{
+		refreshToken:   randomString(),
+		tokenTTL:       defaultTokenTTL,
+		downloadURLTTL: defaultDownloadURLTTL,
+		clock:          clock.Real(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	srv := &Server{
+		cfg:      cfg,
+		idTokens: make(map[string]time.Time),
+		bundles:  make(map[string]*bundle),
+		statuses: make(map[string][]cluster_api.BundleStatus),
+		streams:  make(map[*stream]struct{}),
+		requests: make(map[string]int),
+		failures: make(map[string]*injectedError),
+
+		interruptions: make(map[string]*interruption),
+		holds:         make(map[string]chan struct{}),
+		blobRequests:  make(map[string]int),
+		signKey:       []byte(randomString()),
+	}
+
+	r := chi.NewRouter()
+	r.Get(blobsBasePath+"/{bundleId}", srv.serveBlob)
+	cluster_api.HandlerWithOptions(
+		cluster_api.NewStrictHandler(srv, []cluster_api.StrictMiddlewareFunc{
+			srv.injectErrors, srv.countRequests, srv.authorize,
+		}),
+		cluster_api.ChiServerOptions{
+			BaseURL:    clusterAPIBasePath,
+			BaseRouter: r,
+		},
+	)
+	var grpcOpts []grpc.ServerOption
+	srv.http = httptest.NewUnstartedServer(r)
+	if cfg.tls {
+		srv.http.StartTLS()
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: srv.http.TLS.Certificates,
+			MinVersion:   tls.VersionTLS12,
+		})))
+	} else {
+		srv.http.Start()
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		srv.http.Close()
+		t.Fatalf("listen grpc: %v", err)
+	}
+	srv.grpcListen = lis
+	srv.grpc = grpc.NewServer(grpcOpts...)
+	connect_api.RegisterConnectServer(srv.grpc, &connectServer{srv: srv})
+	go func() { _ = srv.grpc.Serve(lis) }()
+
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Close stops the server, terminating all active connections
+func (srv *Server) Close() {
+	srv.DropStreams()
+	srv.grpc.Stop()
+	srv.http.Close()
+}
+
+// ClusterAPIEndpoint returns the endpoint of the cluster HTTP API
+func (srv *Server) ClusterAPIEndpoint() string {
+	return srv.http.URL + clusterAPIBasePath
+}
+
+// ConnectAPIEndpoint returns the endpoint of the connect gRPC API
+func (srv *Server) ConnectAPIEndpoint() string {
+	if srv.cfg.tls {
+		return "https://" + srv.grpcListen.Addr().String()
+	}
+	return "http://" + srv.grpcListen.Addr().String()
+}
+
+// Certificate returns the self-signed certificate of the server if it serves TLS, see WithTLS
+func (srv *Server) Certificate() *x509.Certificate {
+	return srv.http.Certificate()
+}
+
+// APIToken returns the cluster identity token accepted by the server
+func (srv *Server) APIToken() string {
+	return srv.cfg.refreshToken
+}
+
+// Options returns the options required to point zerosdk.NewAPI to this server.
+// If the server serves TLS, the options trust its certificate.
+func (srv *Server) Options() []zerosdk.Option {
+	opts := []zerosdk.Option{
+		zerosdk.WithClusterAPIEndpoint(srv.ClusterAPIEndpoint()),
+		zerosdk.WithConnectAPIEndpoint(srv.ConnectAPIEndpoint()),
+		zerosdk.WithAPIToken(srv.APIToken()),
+		zerosdk.WithHTTPClient(srv.http.Client()),
+		zerosdk.WithClock(srv.cfg.clock),
+	}
+	if srv.cfg.tls {
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+		opts = append(opts, zerosdk.WithTLSConfig(&tls.Config{
+			RootCAs:    roots,
+			MinVersion: tls.VersionTLS12,
+		}))
+	}
+	return opts
+}
+
+// SetBootstrapConfig sets the bootstrap config returned to the clients.
+// It does not notify the connected clients, see PublishBootstrapConfigUpdated.
+func (srv *Server) SetBootstrapConfig(cfg cluster_api.BootstrapConfig) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.bootstrap = cfg
+}
+
+// BundleStatuses returns all bundle status reports the clients sent for the given bundle, in order
+func (srv *Server) BundleStatuses(bundleID string) []cluster_api.BundleStatus {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	return append([]cluster_api.BundleStatus(nil), srv.statuses[bundleID]...)
+}
+
+// RequestCount returns the number of authorized requests made to the given cluster API operation,
+// i.e. "DownloadClusterResourceBundle"
+func (srv *Server) RequestCount(operationID string) int {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	return srv.requests[operationID]
+}
+
+func (srv *Server) issueToken() string {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	token := randomString()
+	srv.idTokens[token] = srv.cfg.clock.Now().Add(srv.cfg.tokenTTL)
+	return token
+}
+
+func (srv *Server) checkToken(authorization string) error {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return fmt.Errorf("missing bearer token")
+	}
+
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	expires, ok := srv.idTokens[token]
+	if !ok {
+		return fmt.Errorf("unknown bearer token")
+	}
+	if srv.cfg.clock.Now().After(expires) {
+		return fmt.Errorf("bearer token expired")
+	}
+	return nil
+}
+
+func (srv *Server) authorize(f cluster_api.StrictHandlerFunc, operationID string) cluster_api.StrictHandlerFunc {
+	if operationID == "ExchangeClusterIdentityToken" {
+		return f
+	}
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		if err := srv.checkToken(r.Header.Get("Authorization")); err != nil {
+			return errorResponse{status: http.StatusUnauthorized, message: err.Error()}, nil
+		}
+		return f(ctx, w, r, request)
+	}
+}
+
+func (srv *Server) countRequests(f cluster_api.StrictHandlerFunc, operationID string) cluster_api.StrictHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		srv.mx.Lock()
+		srv.requests[operationID]++
+		srv.mx.Unlock()
+
+		return f(ctx, w, r, request)
+	}
+}
+
+type injectedError struct {
+	status int
+	times  int
+}
+
+// InjectError makes the next requests to the cluster API operation fail with the given HTTP status,
+// i.e. "GetClusterBootstrapConfig". If times is negative, the requests fail until ClearErrors is called,
+// if it is zero, InjectError is a no-op.
+func (srv *Server) InjectError(operationID string, status int, times int) {
+	if times == 0 {
+		return
+	}
+
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.failures[operationID] = &injectedError{status: status, times: times}
+}
+
+// ClearErrors removes all injected errors
+func (srv *Server) ClearErrors() {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	srv.failures = make(map[string]*injectedError)
+}
+
+func (srv *Server) nextInjectedError(operationID string) (*injectedError, bool) {
+	srv.mx.Lock()
+	defer srv.mx.Unlock()
+
+	e, ok := srv.failures[operationID]
+	if !ok {
+		return nil, false
+	}
+	if e.times > 0 {
+		if e.times--; e.times == 0 {
+			delete(srv.failures, operationID)
+		}
+	}
+	return e, true
+}
+
+func (srv *Server) injectErrors(f cluster_api.StrictHandlerFunc, operationID string) cluster_api.StrictHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, request interface{}) (interface{}, error) {
+		if e, ok := srv.nextInjectedError(operationID); ok {
+			return errorResponse{status: e.status, message: http.StatusText(e.status)}, nil
+		}
+		return f(ctx, w, r, request)
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}